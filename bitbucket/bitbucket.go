@@ -0,0 +1,474 @@
+// Package bitbucket discovers the repos of Bitbucket Server / Data Center projects that carry a label or a marker file.
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Discovery modes, label uses the repos' labels, file looks for a marker file in each repo's default branch
+const (
+	DiscoveryLabel = "label"
+	DiscoveryFile  = "file"
+)
+
+// DefaultLabel is the repo label that marks repos to seed
+const DefaultLabel = "ci-gocd"
+
+// DefaultMarkerFile is the file that marks repos to seed in file discovery
+const DefaultMarkerFile = ".gocd"
+
+// DefaultLimit is the page size used when listing repos and files
+const DefaultLimit = 100
+
+type link struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type repository struct {
+	ID      int64  `json:"id"`
+	Slug    string `json:"slug"`
+	Project struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Clone []link `json:"clone"`
+	} `json:"links"`
+}
+
+type branch struct {
+	DisplayID string `json:"displayId"`
+}
+
+// page is a page of any paged bitbucket api, values are decoded by the caller
+type page struct {
+	Values        json.RawMessage `json:"values"`
+	IsLastPage    bool            `json:"isLastPage"`
+	NextPageStart int             `json:"nextPageStart"`
+}
+
+// Bitbucket provides Bitbucket Server funcs
+type Bitbucket struct {
+	URL               string
+	Token             string
+	Discovery         string
+	Label             string
+	MarkerFile        string
+	Limit             int
+	ConfigFilePattern string
+	hc                *http.Client
+	ctx               context.Context
+	logger            log.Logger
+}
+
+// Bitbucketer provides funcs to retrieve Bitbucket repos
+type Bitbucketer interface {
+	ProjectRepos(string) ([]*source.Repository, error)
+	HasConfigFile(*source.Repository) (bool, error)
+	FetchFile(*source.Repository, string) ([]byte, bool, error)
+	Branches(*source.Repository) ([]string, error)
+}
+
+// New returns a configured Bitbucket struct
+func New(ctx context.Context, config map[string]string, hc *http.Client, logger log.Logger) (Bitbucketer, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	// there is no public bitbucket server
+	if config["BitbucketURL"] == "" {
+		return nil, errors.Wrap(errors.New("missing bitbucket url"), "environment variable not set")
+	}
+
+	// cannot call bitbucket w/o token
+	if config["BitbucketToken"] == "" {
+		return nil, errors.Wrap(errors.New("missing bitbucket token"), "environment variable not set")
+	}
+
+	discovery := config["BitbucketDiscovery"]
+	if discovery == "" {
+		discovery = DiscoveryLabel
+	}
+	if discovery != DiscoveryLabel && discovery != DiscoveryFile {
+		return nil, fmt.Errorf("invalid discovery mode %s, must be %s or %s", discovery, DiscoveryLabel, DiscoveryFile)
+	}
+
+	label := config["BitbucketLabel"]
+	if label == "" {
+		label = DefaultLabel
+	}
+
+	markerFile := strings.Trim(config["BitbucketMarkerFile"], "/")
+	if markerFile == "" {
+		markerFile = DefaultMarkerFile
+	}
+
+	configFilePattern := config["BitbucketConfigFilePattern"]
+	if configFilePattern == "" {
+		configFilePattern = source.DefaultConfigFilePattern
+	}
+	if _, err := path.Match(configFilePattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file pattern %s", configFilePattern)
+	}
+
+	return &Bitbucket{
+		URL:               strings.TrimSuffix(config["BitbucketURL"], "/") + "/rest/api/1.0",
+		Token:             config["BitbucketToken"],
+		Discovery:         discovery,
+		Label:             label,
+		MarkerFile:        markerFile,
+		Limit:             DefaultLimit,
+		ConfigFilePattern: configFilePattern,
+		hc:                hc,
+		ctx:               ctx,
+		logger:            logger,
+	}, nil
+}
+
+// ProjectRepos implements Bitbucketer and returns the repos of the project that carry the label, or the marker file
+func (b *Bitbucket) ProjectRepos(project string) ([]*source.Repository, error) {
+
+	var foundRepos = make([]*source.Repository, 0)
+
+	var repos []repository
+	var err error
+
+	switch b.Discovery {
+	case DiscoveryFile:
+		repos, err = b.listRepos(fmt.Sprintf("projects/%s/repos", url.PathEscape(project)), nil)
+	default:
+		// the labeled api spans all projects, so it has to be narrowed down to this one
+		repos, err = b.listRepos(fmt.Sprintf("labels/%s/labeled", url.PathEscape(b.Label)), url.Values{"type": []string{"REPOSITORY"}})
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list repos of bitbucket project %s", project)
+	}
+
+	for _, r := range repos {
+
+		if !strings.EqualFold(r.Project.Key, project) {
+			continue
+		}
+
+		defaultBranch, err := b.defaultBranch(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get default branch of %s/%s", r.Project.Key, r.Slug)
+		}
+
+		repo := &source.Repository{
+			ID:            strconv.FormatInt(r.ID, 10),
+			Name:          r.Slug,
+			FullName:      r.Project.Key + "/" + r.Slug,
+			CloneURL:      cloneURL(r.Links.Clone, "http"),
+			SSHURL:        cloneURL(r.Links.Clone, "ssh"),
+			DefaultBranch: defaultBranch,
+		}
+
+		if b.Discovery == DiscoveryFile {
+			marked, err := b.hasFile(repo, b.MarkerFile)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to check %s for marker file %s", repo.FullName, b.MarkerFile)
+			}
+			if !marked {
+				continue
+			}
+		}
+
+		foundRepos = append(foundRepos, repo)
+		level.Debug(b.logger).Log("msg", "found repo: "+repo.FullName)
+	}
+
+	return foundRepos, nil
+}
+
+// HasConfigFile implements Bitbucketer and checks the repo's branch (see source.Repository.Ref) for a file that matches the config
+// file pattern, see source.MatchConfigFile
+func (b *Bitbucket) HasConfigFile(repo *source.Repository) (bool, error) {
+
+	// nothing was ever pushed
+	if repo.DefaultBranch == "" {
+		return false, nil
+	}
+
+	found := false
+	code, err := b.pages(repoPath(repo, "files"), url.Values{"at": []string{repo.Ref()}}, func(values json.RawMessage) (bool, error) {
+		var files []string
+		if err := json.Unmarshal(values, &files); err != nil {
+			return false, err
+		}
+		for _, file := range files {
+			if source.MatchConfigFile(repo.ConfigFilePattern(b.ConfigFilePattern), file) {
+				found = true
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if code == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to list files of %s (%s)", repo.FullName, repo.Ref())
+	}
+
+	return found, nil
+}
+
+// Branches implements Bitbucketer and returns the names of the repo's branches
+func (b *Bitbucket) Branches(repo *source.Repository) ([]string, error) {
+
+	var names []string
+	_, err := b.pages(repoPath(repo, "branches"), nil, func(values json.RawMessage) (bool, error) {
+		var branches []branch
+		if err := json.Unmarshal(values, &branches); err != nil {
+			return false, err
+		}
+		for _, br := range branches {
+			names = append(names, br.DisplayID)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get branches of %s", repo.FullName)
+	}
+
+	return names, nil
+}
+
+// listRepos pages through a bitbucket api that returns repos, a missing label is not an error, it has no repos
+func (b *Bitbucket) listRepos(apiPath string, query url.Values) ([]repository, error) {
+
+	var repos []repository
+	code, err := b.pages(apiPath, query, func(values json.RawMessage) (bool, error) {
+		var rs []repository
+		if err := json.Unmarshal(values, &rs); err != nil {
+			return false, err
+		}
+		repos = append(repos, rs...)
+		return true, nil
+	})
+	if code == http.StatusNotFound && b.Discovery == DiscoveryLabel {
+		return nil, nil
+	}
+
+	return repos, err
+}
+
+// pages follows bitbucket's start / isLastPage paging and passes each page's values to fn until fn returns false,
+// it returns the status of the last response
+func (b *Bitbucket) pages(apiPath string, query url.Values, fn func(json.RawMessage) (bool, error)) (int, error) {
+
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("limit", strconv.Itoa(b.Limit))
+
+	start := 0
+	for {
+
+		if err := b.ctx.Err(); err != nil {
+			return 0, errors.Wrap(err, "stopped paging through bitbucket api")
+		}
+
+		query.Set("start", strconv.Itoa(start))
+
+		var p page
+		resp, err := b.get(apiPath+"?"+query.Encode(), &p)
+		if err != nil {
+			return status(resp), err
+		}
+
+		more, err := fn(p.Values)
+		if err != nil {
+			return resp.StatusCode, errors.Wrap(err, "error unmarshaling page values")
+		}
+
+		if !more || p.IsLastPage {
+			return resp.StatusCode, nil
+		}
+		start = p.NextPageStart
+	}
+}
+
+// defaultBranch returns the repo's default branch, or an empty string for an empty repo
+func (b *Bitbucket) defaultBranch(r repository) (string, error) {
+
+	var br branch
+	resp, err := b.get(fmt.Sprintf("projects/%s/repos/%s/branches/default", url.PathEscape(r.Project.Key), url.PathEscape(r.Slug)), &br)
+	if status(resp) == http.StatusNotFound || status(resp) == http.StatusNoContent {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return br.DisplayID, nil
+}
+
+// hasFile returns true if the file exists in the repo's default branch
+func (b *Bitbucket) hasFile(repo *source.Repository, file string) (bool, error) {
+
+	if repo.DefaultBranch == "" {
+		return false, nil
+	}
+
+	var v struct {
+		Type string `json:"type"`
+	}
+	query := url.Values{"at": []string{repo.DefaultBranch}, "type": []string{"true"}}
+	resp, err := b.get(repoPath(repo, "browse/"+file)+"?"+query.Encode(), &v)
+	if status(resp) == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return v.Type == "FILE", nil
+}
+
+// FetchFile implements Bitbucketer and returns the content of a file in the repo's default branch
+func (b *Bitbucket) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+
+	if repo.DefaultBranch == "" {
+		return nil, false, nil
+	}
+
+	query := url.Values{"at": []string{repo.DefaultBranch}}
+	resp, content, err := b.raw(repoPath(repo, "raw/"+file)+"?"+query.Encode(), "text/plain")
+	if status(resp) == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to get %s of %s (%s)", file, repo.FullName, repo.DefaultBranch)
+	}
+
+	return content, true, nil
+}
+
+// get requests a bitbucket api path and decodes the response into v
+func (b *Bitbucket) get(apiPath string, v interface{}) (*http.Response, error) {
+
+	resp, body, err := b.raw(apiPath, "application/json")
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return resp, nil
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return resp, errors.Wrap(err, "error unmarshaling json from response body")
+	}
+
+	return resp, nil
+}
+
+// raw requests a bitbucket api path and returns the response's body
+func (b *Bitbucket) raw(apiPath string, accept string) (*http.Response, []byte, error) {
+
+	req, err := http.NewRequest(http.MethodGet, b.URL+"/"+apiPath, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating http request")
+	}
+	req = req.WithContext(b.ctx)
+	req.Header.Set("Authorization", "Bearer "+b.Token)
+	req.Header.Set("Accept", accept)
+
+	resp, err := b.hc.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error doing http request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, errors.Wrap(err, "error reading response body")
+	}
+
+	if resp.StatusCode > 399 {
+		return resp, nil, errors.Wrap(errors.New(resp.Status), "invalid response status")
+	}
+
+	return resp, body, nil
+}
+
+// repoPath returns the api path of a repo's sub resource, FullName is <project key>/<slug>
+func repoPath(repo *source.Repository, resource string) string {
+	key, slug := repo.FullName, ""
+	if i := strings.Index(repo.FullName, "/"); i > -1 {
+		key, slug = repo.FullName[:i], repo.FullName[i+1:]
+	}
+	return fmt.Sprintf("projects/%s/repos/%s/%s", url.PathEscape(key), url.PathEscape(slug), resource)
+}
+
+// cloneURL returns the repo's clone url for the protocol, bitbucket names them http and ssh
+func cloneURL(links []link, name string) string {
+	for _, l := range links {
+		if l.Name == name {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func status(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// ProjectSource is a source.Source for the repos of a single Bitbucket project
+type ProjectSource struct {
+	bitbucket Bitbucketer
+	project   string
+}
+
+// NewProjectSource returns a source.Source for the project's repos
+func NewProjectSource(bitbucket Bitbucketer, project string) *ProjectSource {
+	return &ProjectSource{bitbucket: bitbucket, project: project}
+}
+
+// Repos implements source.Source, no repos are ever skipped
+func (s *ProjectSource) Repos() ([]*source.Repository, []*source.Repository, error) {
+	repos, err := s.bitbucket.ProjectRepos(s.project)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repos, nil, nil
+}
+
+// HasConfigFile implements source.Source
+func (s *ProjectSource) HasConfigFile(repo *source.Repository) (bool, error) {
+	return s.bitbucket.HasConfigFile(repo)
+}
+
+// Branches implements source.BranchLister
+func (s *ProjectSource) Branches(repo *source.Repository) ([]string, error) {
+	return s.bitbucket.Branches(repo)
+}
+
+// FetchFile implements source.FileFetcher
+func (s *ProjectSource) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+	return s.bitbucket.FetchFile(repo, file)
+}
@@ -0,0 +1,204 @@
+package bitbucket_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/bitbucket"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// repoJSON returns a repo as the bitbucket api returns it
+func repoJSON(id int, slug, key string) string {
+	return fmt.Sprintf(`{"id": %d, "slug": "%s", "project": {"key": "%s"}, "links": {"clone": [
+		{"href": "https://bitbucket.example.com/scm/%[3]s/%[2]s.git", "name": "http"},
+		{"href": "ssh://git@bitbucket.example.com:7999/%[3]s/%[2]s.git", "name": "ssh"}
+	]}}`, id, slug, key)
+}
+
+func TestNewWithoutURL(t *testing.T) {
+	b, err := bitbucket.New(nil, map[string]string{"BitbucketToken": "aabbcc"}, nil, log.NewNopLogger())
+
+	assert.NotNil(t, err)
+	assert.Nil(t, b)
+}
+
+func TestNewInvalidDiscovery(t *testing.T) {
+	b, err := bitbucket.New(nil, map[string]string{
+		"BitbucketURL":       "https://bitbucket.example.com",
+		"BitbucketToken":     "aabbcc",
+		"BitbucketDiscovery": "topic",
+	}, nil, log.NewNopLogger())
+
+	assert.NotNil(t, err)
+	assert.Nil(t, b)
+}
+
+func TestProjectReposLabel(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer aabbcc", r.Header.Get("Authorization"))
+
+			switch r.URL.Path {
+			case "/rest/api/1.0/labels/ci-gocd/labeled":
+				assert.Equal(t, "REPOSITORY", r.URL.Query().Get("type"))
+				switch r.URL.Query().Get("start") {
+				case "0":
+					fmt.Fprintf(w, `{"values": [%s, %s], "isLastPage": false, "nextPageStart": 2}`,
+						repoJSON(1, "one", "LEG"), repoJSON(2, "other", "OPS"))
+				case "2":
+					fmt.Fprintf(w, `{"values": [%s], "isLastPage": true}`, repoJSON(3, "empty", "LEG"))
+				default:
+					t.Fatalf("unexpected start %s", r.URL.Query().Get("start"))
+				}
+			case "/rest/api/1.0/projects/LEG/repos/one/branches/default":
+				fmt.Fprintf(w, `{"id": "refs/heads/main", "displayId": "main"}`)
+			case "/rest/api/1.0/projects/LEG/repos/empty/branches/default":
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				t.Fatalf("unexpected path %s", r.URL.Path)
+			}
+		}))
+	defer hs.Close()
+
+	b, err := bitbucket.New(
+		context.Background(),
+		map[string]string{
+			"BitbucketURL":   hs.URL,
+			"BitbucketToken": "aabbcc",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	repos, err := b.ProjectRepos("LEG")
+	assert.Nil(t, err)
+	assert.Equal(t, []*source.Repository{
+		{
+			ID:            "1",
+			Name:          "one",
+			FullName:      "LEG/one",
+			CloneURL:      "https://bitbucket.example.com/scm/LEG/one.git",
+			SSHURL:        "ssh://git@bitbucket.example.com:7999/LEG/one.git",
+			DefaultBranch: "main",
+		},
+		{
+			ID:       "3",
+			Name:     "empty",
+			FullName: "LEG/empty",
+			CloneURL: "https://bitbucket.example.com/scm/LEG/empty.git",
+			SSHURL:   "ssh://git@bitbucket.example.com:7999/LEG/empty.git",
+		},
+	}, repos)
+}
+
+func TestProjectReposUnknownLabel(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	defer hs.Close()
+
+	b, err := bitbucket.New(
+		context.Background(),
+		map[string]string{
+			"BitbucketURL":   hs.URL,
+			"BitbucketToken": "aabbcc",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	repos, err := b.ProjectRepos("LEG")
+	assert.Nil(t, err)
+	assert.Len(t, repos, 0)
+}
+
+func TestProjectReposMarkerFile(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/rest/api/1.0/projects/LEG/repos":
+				fmt.Fprintf(w, `{"values": [%s, %s], "isLastPage": true}`, repoJSON(1, "one", "LEG"), repoJSON(2, "two", "LEG"))
+			case "/rest/api/1.0/projects/LEG/repos/one/branches/default",
+				"/rest/api/1.0/projects/LEG/repos/two/branches/default":
+				fmt.Fprintf(w, `{"displayId": "master"}`)
+			case "/rest/api/1.0/projects/LEG/repos/one/browse/.gocd":
+				assert.Equal(t, "master", r.URL.Query().Get("at"))
+				fmt.Fprintf(w, `{"type": "FILE"}`)
+			case "/rest/api/1.0/projects/LEG/repos/two/browse/.gocd":
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				t.Fatalf("unexpected path %s", r.URL.Path)
+			}
+		}))
+	defer hs.Close()
+
+	b, err := bitbucket.New(
+		context.Background(),
+		map[string]string{
+			"BitbucketURL":       hs.URL,
+			"BitbucketToken":     "aabbcc",
+			"BitbucketDiscovery": "file",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	repos, err := b.ProjectRepos("LEG")
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 1) {
+		assert.Equal(t, "LEG/one", repos[0].FullName)
+	}
+}
+
+func TestHasConfigFile(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/rest/api/1.0/projects/LEG/repos/one/files":
+				assert.Equal(t, "main", r.URL.Query().Get("at"))
+				if r.URL.Query().Get("start") == "0" {
+					fmt.Fprintf(w, `{"values": ["README.md"], "isLastPage": false, "nextPageStart": 1}`)
+					return
+				}
+				fmt.Fprintf(w, `{"values": ["ci/ci.gocd.yaml"], "isLastPage": true}`)
+			case "/rest/api/1.0/projects/LEG/repos/two/files":
+				fmt.Fprintf(w, `{"values": ["README.md"], "isLastPage": true}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	b, err := bitbucket.New(
+		context.Background(),
+		map[string]string{
+			"BitbucketURL":   hs.URL,
+			"BitbucketToken": "aabbcc",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	configured, err := b.HasConfigFile(&source.Repository{FullName: "LEG/one", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.True(t, configured)
+
+	configured, err = b.HasConfigFile(&source.Repository{FullName: "LEG/two", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.False(t, configured)
+
+	configured, err = b.HasConfigFile(&source.Repository{FullName: "LEG/three", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.False(t, configured)
+}
@@ -0,0 +1,147 @@
+// Package deploykey gives config repos cloned over ssh a read-only deploy key of their own.
+package deploykey
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alex-leonhardt/gocd-seeder/gocd"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Keyer is implemented by sources that can register deploy keys with repos
+type Keyer interface {
+	// AddDeployKey registers the public key as a read-only deploy key of the repo
+	AddDeployKey(repo *source.Repository, title string, publicKey string) error
+	// RemoveDeployKeys removes all of the repo's deploy keys with the title, a missing repo is not an error
+	RemoveDeployKeys(fullName string, title string) error
+}
+
+// ConfigRepos is a gocd.ConfigRepoInterface that provisions a deploy key for each config repo it creates, and removes
+// it when the config repo is deleted; a config repo that is created again gets a new key
+type ConfigRepos struct {
+	gocd.ConfigRepoInterface
+	keys   Keyer
+	sink   Sink
+	logger log.Logger
+}
+
+// New returns config repos whose deploy keys are registered with keys, and whose private keys are put into the sink
+func New(configRepos gocd.ConfigRepoInterface, keys Keyer, sink Sink, logger log.Logger) *ConfigRepos {
+	return &ConfigRepos{
+		ConfigRepoInterface: configRepos,
+		keys:                keys,
+		sink:                sink,
+		logger:              logger,
+	}
+}
+
+// Title returns the title of the config repo's deploy key
+func Title(id string) string {
+	return "gocd-seeder " + id
+}
+
+// CreateConfigRepo implements gocd.ConfigRepoInterface, the config repo is cloned from an alias of the repo's ssh host
+// (<id>.<host>) that the sink maps to the deploy key
+func (c *ConfigRepos) CreateConfigRepo(repo *source.Repository, prefix string) (gocd.ConfigRepo, error) {
+
+	id := gocd.ConfigRepoID(repo, prefix)
+
+	host, repoPath, err := splitSSHURL(repo.SSHURL)
+	if err != nil {
+		return gocd.ConfigRepo{}, errors.Wrap(err, "unable to provision deploy key for "+id)
+	}
+
+	// keys left behind by an earlier config repo with the same id are not used any more
+	if err := c.keys.RemoveDeployKeys(repo.FullName, Title(id)); err != nil {
+		return gocd.ConfigRepo{}, errors.Wrap(err, "unable to remove old deploy keys of "+id)
+	}
+
+	pair, err := Generate(id)
+	if err != nil {
+		return gocd.ConfigRepo{}, err
+	}
+
+	if err := c.keys.AddDeployKey(repo, Title(id), string(pair.Public)); err != nil {
+		return gocd.ConfigRepo{}, errors.Wrap(err, "unable to add deploy key for "+id)
+	}
+
+	alias := id + "." + host
+	key := Key{ID: id, Repo: repo.FullName, Host: host, Alias: alias, PrivateKey: string(pair.Private)}
+	if err := c.sink.Put(key); err != nil {
+		c.revoke(repo.FullName, id)
+		return gocd.ConfigRepo{}, errors.Wrap(err, "unable to put deploy key of "+id)
+	}
+
+	aliased := *repo
+	aliased.SSHURL = "git@" + alias + ":" + repoPath
+
+	created, err := c.ConfigRepoInterface.CreateConfigRepo(&aliased, prefix)
+	if err != nil {
+		c.revoke(repo.FullName, id)
+		return created, err
+	}
+
+	level.Debug(c.logger).Log("msg", "provisioned deploy key for "+id)
+
+	return created, nil
+}
+
+// UpdateConfigRepo implements gocd.ConfigRepoInterface, a config repo with a deploy key keeps being cloned from its
+// host alias, e.g. after the repo was renamed; the key moves along with the repo
+func (c *ConfigRepos) UpdateConfigRepo(existing gocd.ConfigRepo, repo *source.Repository, prefix string) (gocd.ConfigRepo, bool, error) {
+
+	aliased := *repo
+	host, _, err := splitSSHURL(existing.Material.Attributes.URL)
+	if err == nil && strings.HasPrefix(host, existing.ID+".") {
+		if _, repoPath, err := splitSSHURL(repo.SSHURL); err == nil {
+			aliased.SSHURL = "git@" + host + ":" + repoPath
+		}
+	}
+
+	return c.ConfigRepoInterface.UpdateConfigRepo(existing, &aliased, prefix)
+}
+
+// DeleteConfigRepo implements gocd.ConfigRepoInterface, the config repo's deploy key is removed once it is deleted
+func (c *ConfigRepos) DeleteConfigRepo(configRepo *gocd.ConfigRepo, prefix string) (*http.Response, error) {
+
+	resp, err := c.ConfigRepoInterface.DeleteConfigRepo(configRepo, prefix)
+	if err != nil {
+		return resp, err
+	}
+
+	// config repos created before deploy keys were provisioned, or w/o ssh, don't have one
+	host, repoPath, err := splitSSHURL(configRepo.Material.Attributes.URL)
+	if err != nil || !strings.HasPrefix(host, configRepo.ID+".") {
+		return resp, nil
+	}
+
+	c.revoke(strings.TrimSuffix(repoPath, ".git"), configRepo.ID)
+
+	return resp, nil
+}
+
+// revoke removes the config repo's deploy key from the repo and the sink, failures are logged as the config repo is
+// gone (or never came to be) anyway
+func (c *ConfigRepos) revoke(fullName string, id string) {
+	if err := c.keys.RemoveDeployKeys(fullName, Title(id)); err != nil {
+		level.Error(c.logger).Log("msg", errors.Wrap(err, "unable to remove deploy key of "+id))
+	}
+	if err := c.sink.Delete(id); err != nil {
+		level.Error(c.logger).Log("msg", errors.Wrap(err, "unable to delete deploy key of "+id))
+	}
+}
+
+// splitSSHURL splits an scp like ssh url, e.g. git@github.com:gooflix/one.git, into its host and path
+func splitSSHURL(sshURL string) (string, string, error) {
+	at := strings.Index(sshURL, "@")
+	colon := strings.Index(sshURL, ":")
+	if at < 0 || colon < at || strings.Contains(sshURL, "://") {
+		return "", "", fmt.Errorf("unsupported ssh url %q", sshURL)
+	}
+	return sshURL[at+1 : colon], sshURL[colon+1:], nil
+}
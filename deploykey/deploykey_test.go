@@ -0,0 +1,222 @@
+package deploykey_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/deploykey"
+	"github.com/alex-leonhardt/gocd-seeder/gocd"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	pair, err := deploykey.Generate("gooflix-one")
+	assert.Nil(t, err)
+
+	assert.True(t, strings.HasPrefix(string(pair.Public), "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5"))
+	assert.True(t, strings.HasSuffix(string(pair.Public), " gooflix-one"))
+
+	block, _ := pem.Decode(pair.Private)
+	if assert.NotNil(t, block) {
+		assert.Equal(t, "OPENSSH PRIVATE KEY", block.Type)
+		assert.True(t, bytes.HasPrefix(block.Bytes, []byte("openssh-key-v1\x00")))
+	}
+
+	other, err := deploykey.Generate("gooflix-one")
+	assert.Nil(t, err)
+	assert.NotEqual(t, pair.Public, other.Public)
+}
+
+// fakeKeys implements deploykey.Keyer and records the keys of each repo by title
+type fakeKeys struct {
+	keys map[string]string
+	fail bool
+}
+
+func (f *fakeKeys) AddDeployKey(repo *source.Repository, title string, publicKey string) error {
+	if f.fail {
+		return errors.New("422 Unprocessable Entity")
+	}
+	f.keys[repo.FullName+" "+title] = publicKey
+	return nil
+}
+
+func (f *fakeKeys) RemoveDeployKeys(fullName string, title string) error {
+	delete(f.keys, fullName+" "+title)
+	return nil
+}
+
+// fakeConfigRepos implements gocd.ConfigRepoInterface and records the created config repos
+type fakeConfigRepos struct {
+	gocd.ConfigRepoInterface
+	created []*source.Repository
+	updated []*source.Repository
+}
+
+func (f *fakeConfigRepos) CreateConfigRepo(repo *source.Repository, prefix string) (gocd.ConfigRepo, error) {
+	f.created = append(f.created, repo)
+	return gocd.ConfigRepo{ID: gocd.ConfigRepoID(repo, prefix)}, nil
+}
+
+func (f *fakeConfigRepos) UpdateConfigRepo(existing gocd.ConfigRepo, repo *source.Repository, prefix string) (gocd.ConfigRepo, bool, error) {
+	f.updated = append(f.updated, repo)
+	return existing, true, nil
+}
+
+func (f *fakeConfigRepos) DeleteConfigRepo(configRepo *gocd.ConfigRepo, prefix string) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func TestConfigRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploykey")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	keys := &fakeKeys{keys: map[string]string{}}
+	inner := &fakeConfigRepos{}
+
+	configRepos := deploykey.New(inner, keys, &deploykey.DirSink{Path: dir}, log.NewNopLogger())
+
+	repo := &source.Repository{Name: "one", FullName: "gooflix/one", SSHURL: "git@github.com:gooflix/one.git"}
+	_, err = configRepos.CreateConfigRepo(repo, "gooflix")
+	assert.Nil(t, err)
+
+	// the config repo is cloned from the alias, the original repo isn't changed
+	if assert.Len(t, inner.created, 1) {
+		assert.Equal(t, "git@gooflix-one.github.com:gooflix/one.git", inner.created[0].SSHURL)
+	}
+	assert.Equal(t, "git@github.com:gooflix/one.git", repo.SSHURL)
+	assert.Contains(t, keys.keys, "gooflix/one gocd-seeder gooflix-one")
+
+	private, err := ioutil.ReadFile(filepath.Join(dir, "gooflix-one"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(private), "OPENSSH PRIVATE KEY")
+	conf, err := ioutil.ReadFile(filepath.Join(dir, "gooflix-one.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(conf), "Host gooflix-one.github.com\n  HostName github.com\n")
+
+	// deleting the config repo removes its key
+	configRepo := gocd.ConfigRepo{ID: "gooflix-one"}
+	configRepo.Material.Attributes.URL = "git@gooflix-one.github.com:gooflix/one.git"
+	_, err = configRepos.DeleteConfigRepo(&configRepo, "gooflix")
+	assert.Nil(t, err)
+	assert.Len(t, keys.keys, 0)
+	_, err = ioutil.ReadFile(filepath.Join(dir, "gooflix-one"))
+	assert.NotNil(t, err)
+}
+
+func TestConfigReposKeyFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploykey")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	inner := &fakeConfigRepos{}
+
+	configRepos := deploykey.New(inner, &fakeKeys{keys: map[string]string{}, fail: true}, &deploykey.DirSink{Path: dir}, log.NewNopLogger())
+
+	_, err = configRepos.CreateConfigRepo(&source.Repository{Name: "one", FullName: "gooflix/one", SSHURL: "git@github.com:gooflix/one.git"}, "gooflix")
+	assert.NotNil(t, err)
+	assert.Len(t, inner.created, 0)
+
+	// w/o an ssh url there's nothing to clone with a key
+	configRepos = deploykey.New(inner, &fakeKeys{keys: map[string]string{}}, &deploykey.DirSink{Path: dir}, log.NewNopLogger())
+	_, err = configRepos.CreateConfigRepo(&source.Repository{Name: "one", CloneURL: "https://github.com/gooflix/one.git"}, "gooflix")
+	assert.NotNil(t, err)
+	assert.Len(t, inner.created, 0)
+}
+
+func TestConfigReposUpdateRenamed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploykey")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	inner := &fakeConfigRepos{}
+	configRepos := deploykey.New(inner, &fakeKeys{keys: map[string]string{}}, &deploykey.DirSink{Path: dir}, log.NewNopLogger())
+
+	// the repo was renamed from one to uno, its config repo keeps cloning from the alias with the key
+	existing := gocd.ConfigRepo{ID: "gooflix-one"}
+	existing.Material.Attributes.URL = "git@gooflix-one.github.com:gooflix/one.git"
+	repo := &source.Repository{Name: "uno", FullName: "gooflix/uno", SSHURL: "git@github.com:gooflix/uno.git", ConfigRepoID: "gooflix-one"}
+
+	_, _, err = configRepos.UpdateConfigRepo(existing, repo, "gooflix")
+	assert.Nil(t, err)
+	if assert.Len(t, inner.updated, 1) {
+		assert.Equal(t, "git@gooflix-one.github.com:gooflix/uno.git", inner.updated[0].SSHURL)
+	}
+
+	// config repos w/o a deploy key are updated as they are
+	existing.Material.Attributes.URL = "https://github.com/gooflix/one.git"
+	_, _, err = configRepos.UpdateConfigRepo(existing, repo, "gooflix")
+	assert.Nil(t, err)
+	if assert.Len(t, inner.updated, 2) {
+		assert.Equal(t, "git@github.com:gooflix/uno.git", inner.updated[1].SSHURL)
+	}
+}
+
+func TestConfigReposUpdateHTTPS(t *testing.T) {
+	var puts []gocd.ConfigRepo
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var put gocd.ConfigRepo
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&put))
+			puts = append(puts, put)
+			json.NewEncoder(w).Encode(put)
+		}))
+	defer hs.Close()
+
+	// config repos are cloned over ssh now, this one was created over https before
+	myGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL, "GoCDCloneProtocol": gocd.ProtocolSSH}, hs.Client(), log.NewNopLogger())
+	dir, err := ioutil.TempDir("", "deploykey")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	keys := &fakeKeys{keys: map[string]string{}}
+	configRepos := deploykey.New(myGoCD, keys, &deploykey.DirSink{Path: dir}, log.NewNopLogger())
+
+	existing := gocd.ConfigRepo{ID: "gooflix-one", PluginID: gocd.DefaultPluginID}
+	existing.Material.Attributes.URL = "https://github.com/gooflix/one.git"
+	existing.Material.Attributes.Name = "one"
+	existing.Material.Attributes.Branch = "main"
+	existing.Material.Attributes.AutoUpdate = true
+
+	repo := &source.Repository{
+		Name:          "one",
+		FullName:      "gooflix/one",
+		CloneURL:      "https://github.com/gooflix/one.git",
+		SSHURL:        "git@github.com:gooflix/one.git",
+		DefaultBranch: "main",
+	}
+
+	// it has no key to clone with over ssh, so it keeps its url
+	_, changed, err := configRepos.UpdateConfigRepo(existing, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Len(t, puts, 0)
+
+	// and keeps cloning over https after the repo was renamed
+	renamed := *repo
+	renamed.Name = "uno"
+	renamed.FullName = "gooflix/uno"
+	renamed.CloneURL = "https://github.com/gooflix/uno.git"
+	renamed.SSHURL = "git@github.com:gooflix/uno.git"
+	renamed.ConfigRepoID = "gooflix-one"
+
+	_, changed, err = configRepos.UpdateConfigRepo(existing, &renamed, "gooflix")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	if assert.Len(t, puts, 1) {
+		assert.Equal(t, "https://github.com/gooflix/uno.git", puts[0].Material.Attributes.URL)
+		assert.Equal(t, "uno", puts[0].Material.Attributes.Name)
+	}
+	assert.Len(t, keys.keys, 0)
+}
@@ -0,0 +1,78 @@
+package deploykey
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// KeyPair is an ssh key pair, Public is in authorized_keys format, Private is in OpenSSH's PEM format
+type KeyPair struct {
+	Public  []byte
+	Private []byte
+}
+
+// Generate returns a new ed25519 key pair with the comment
+func Generate(comment string) (KeyPair, error) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, errors.Wrap(err, "unable to generate ed25519 key")
+	}
+
+	pubBlob := sshString(nil, []byte("ssh-ed25519"))
+	pubBlob = sshString(pubBlob, pub)
+
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return KeyPair{}, errors.Wrap(err, "unable to generate check bytes")
+	}
+
+	// see PROTOCOL.key in the openssh sources, the private section is not encrypted
+	privSection := append(check[:], check[:]...)
+	privSection = sshString(privSection, []byte("ssh-ed25519"))
+	privSection = sshString(privSection, pub)
+	privSection = sshString(privSection, priv)
+	privSection = sshString(privSection, []byte(comment))
+	for i := byte(1); len(privSection)%8 != 0; i++ {
+		privSection = append(privSection, i)
+	}
+
+	key := append([]byte("openssh-key-v1"), 0)
+	key = sshString(key, []byte("none"))
+	key = sshString(key, []byte("none"))
+	key = sshString(key, nil)
+	key = sshUint32(key, 1)
+	key = sshString(key, pubBlob)
+	key = sshString(key, privSection)
+
+	var public bytes.Buffer
+	public.WriteString("ssh-ed25519 ")
+	public.WriteString(base64.StdEncoding.EncodeToString(pubBlob))
+	if comment != "" {
+		public.WriteString(" " + comment)
+	}
+
+	return KeyPair{
+		Public:  public.Bytes(),
+		Private: pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: key}),
+	}, nil
+}
+
+// sshString appends s to b as an ssh wire format string, i.e. prefixed with its length
+func sshString(b []byte, s []byte) []byte {
+	b = sshUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// sshUint32 appends n to b as an ssh wire format uint32, i.e. big endian
+func sshUint32(b []byte, n uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], n)
+	return append(b, buf[:]...)
+}
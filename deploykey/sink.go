@@ -0,0 +1,138 @@
+package deploykey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Key is a deploy key's private key as it is reported to a sink, Alias is the host of the config repo's clone url
+// that has to be mapped to Host with the key, e.g. in ~/.ssh/config
+type Key struct {
+	ID         string `json:"id"`
+	Repo       string `json:"repo"`
+	Host       string `json:"host"`
+	Alias      string `json:"alias"`
+	PrivateKey string `json:"private_key"`
+}
+
+// Sink receives the private keys of deploy keys, so GoCD can clone the repos
+type Sink interface {
+	// Put stores the key of the config repo, replacing any earlier one
+	Put(Key) error
+	// Delete removes the key of the config repo, a missing key is not an error
+	Delete(id string) error
+}
+
+// NewSink returns the sink for the spec, an http(s) url or a directory
+func NewSink(ctx context.Context, spec string, hc *http.Client) (Sink, error) {
+
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		if hc == nil {
+			hc = http.DefaultClient
+		}
+		return &HTTPSink{URL: strings.TrimSuffix(spec, "/"), hc: hc, ctx: ctx}, nil
+	}
+
+	info, err := os.Stat(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid deploy key sink")
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid deploy key sink, %s is not a directory", spec)
+	}
+
+	return &DirSink{Path: spec}, nil
+}
+
+// DirSink writes each private key to a file named after the config repo, next to an ssh config file (<id>.conf) that
+// maps the alias to the host with the key; GoCD's ~/.ssh/config is to include <dir>/*.conf
+type DirSink struct {
+	Path string
+}
+
+// Put implements Sink
+func (s *DirSink) Put(key Key) error {
+
+	keyFile := filepath.Join(s.Path, key.ID)
+	if err := ioutil.WriteFile(keyFile, []byte(key.PrivateKey), 0600); err != nil {
+		return errors.Wrap(err, "unable to write deploy key")
+	}
+
+	conf := fmt.Sprintf("# %s\nHost %s\n  HostName %s\n  User git\n  IdentityFile %s\n  IdentitiesOnly yes\n", key.Repo, key.Alias, key.Host, keyFile)
+	if err := ioutil.WriteFile(keyFile+".conf", []byte(conf), 0644); err != nil {
+		return errors.Wrap(err, "unable to write deploy key ssh config")
+	}
+
+	return nil
+}
+
+// Delete implements Sink
+func (s *DirSink) Delete(id string) error {
+	for _, file := range []string{filepath.Join(s.Path, id), filepath.Join(s.Path, id+".conf")} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "unable to remove deploy key")
+		}
+	}
+	return nil
+}
+
+// HTTPSink PUTs each key as json to <url>/<id>, and DELETEs it from there
+type HTTPSink struct {
+	URL string
+	hc  *http.Client
+	ctx context.Context
+}
+
+// Put implements Sink
+func (s *HTTPSink) Put(key Key) error {
+
+	body, err := json.Marshal(key)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling deploy key")
+	}
+
+	_, err = s.do(http.MethodPut, key.ID, bytes.NewReader(body))
+	return err
+}
+
+// Delete implements Sink
+func (s *HTTPSink) Delete(id string) error {
+	code, err := s.do(http.MethodDelete, id, nil)
+	if code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// do sends the request and returns the response's status
+func (s *HTTPSink) do(method string, id string, body io.Reader) (int, error) {
+
+	req, err := http.NewRequest(method, s.URL+"/"+id, body)
+	if err != nil {
+		return 0, errors.Wrap(err, "error creating http request")
+	}
+	req = req.WithContext(s.ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.hc.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "error doing http request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 399 {
+		return resp.StatusCode, errors.Wrap(errors.New(resp.Status), "invalid response status")
+	}
+
+	return resp.StatusCode, nil
+}
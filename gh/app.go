@@ -0,0 +1,179 @@
+package gh
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// appTokenRefresh is how long before it expires an installation token is refreshed
+const appTokenRefresh = 5 * time.Minute
+
+// appTokenSource is an oauth2.TokenSource that authenticates as a Github App installation, it signs a JWT with
+// the app's private key and exchanges it for an installation token
+type appTokenSource struct {
+	AppID          int64
+	InstallationID int64
+	key            *rsa.PrivateKey
+	client         *github.Client
+	ctx            context.Context
+}
+
+// NewAppTokenSource returns a token source for the app's installation that refreshes the installation token
+// before it expires; baseURL is the Github Enterprise Server's url, or empty for github.com
+func NewAppTokenSource(ctx context.Context, hc *http.Client, baseURL string, appID string, installationID string, privateKey string) (oauth2.TokenSource, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var err error
+	ts := &appTokenSource{ctx: ctx}
+
+	ts.AppID, err = strconv.ParseInt(appID, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid github app id %q", appID)
+	}
+
+	ts.InstallationID, err = strconv.ParseInt(installationID, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid github app installation id %q", installationID)
+	}
+
+	ts.key, err = parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid github app private key")
+	}
+
+	// a client w/o any auth, the JWT is set per request as it's only valid for a few minutes
+	ts.client, err = newGithubClient(hc, baseURL, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &reuseTokenSource{source: ts}, nil
+}
+
+// Token implements oauth2.TokenSource and exchanges a freshly signed JWT for an installation token
+func (ts *appTokenSource) Token() (*oauth2.Token, error) {
+
+	jwt, err := ts.jwt(time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign github app jwt")
+	}
+
+	req, err := ts.client.NewRequest(http.MethodPost, fmt.Sprintf("app/installations/%d/access_tokens", ts.InstallationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+
+	var token github.InstallationToken
+	resp, err := ts.client.Do(ts.ctx, req, &token)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create github app installation token: %v", status(resp))
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt(),
+	}, nil
+}
+
+// jwt returns a JWT signed with RS256 as described in
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (ts *appTokenSource) jwt(now time.Time) (string, error) {
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	// issued in the past to allow for clock drift, github accepts at most 10 minutes of validity
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": ts.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, ts.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA private key, github hands out PKCS1 keys, PKCS8 is accepted as well
+func parsePrivateKey(value string) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+
+	return rsaKey, nil
+}
+
+// reuseTokenSource returns the current token until it's about to expire, oauth2.ReuseTokenSource only refreshes
+// a few seconds before a token expires, which is too late for requests that are paging through a large org
+type reuseTokenSource struct {
+	source oauth2.TokenSource
+	token  *oauth2.Token
+	mu     sync.Mutex
+}
+
+// Token implements oauth2.TokenSource
+func (r *reuseTokenSource) Token() (*oauth2.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token != nil && time.Now().Add(appTokenRefresh).Before(r.token.Expiry) {
+		return r.token, nil
+	}
+
+	token, err := r.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	r.token = token
+
+	return token, nil
+}
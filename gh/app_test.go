@@ -0,0 +1,132 @@
+package gh_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeTokenEndpoint returns a fake github api that hands out installation tokens valid for the given duration,
+// after verifying the app's JWT with the public key
+func newFakeTokenEndpoint(t *testing.T, key *rsa.PrivateKey, valid time.Duration, issued *int) *httptest.Server {
+	return httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/api/v3/app/installations/42/access_tokens", r.URL.Path)
+
+			jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			parts := strings.Split(jwt, ".")
+			if !assert.Len(t, parts, 3) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var claims map[string]int64
+			payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			json.Unmarshal(payload, &claims)
+			assert.Equal(t, int64(12345), claims["iss"])
+
+			*issued++
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": "ghs_%d", "expires_at": "%s"}`, *issued, time.Now().Add(valid).UTC().Format(time.RFC3339))
+		}))
+}
+
+func newTestKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func TestAppTokenSource(t *testing.T) {
+	key, keyPEM := newTestKey(t)
+
+	issued := 0
+	hs := newFakeTokenEndpoint(t, key, time.Hour, &issued)
+	defer hs.Close()
+
+	ts, err := gh.NewAppTokenSource(context.Background(), hs.Client(), hs.URL, "12345", "42", keyPEM)
+	assert.Nil(t, err)
+
+	token, err := ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "ghs_1", token.AccessToken)
+
+	// still valid for long enough, so it's reused
+	token, err = ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "ghs_1", token.AccessToken)
+	assert.Equal(t, 1, issued)
+}
+
+func TestAppTokenSourceRefresh(t *testing.T) {
+	key, keyPEM := newTestKey(t)
+
+	issued := 0
+	hs := newFakeTokenEndpoint(t, key, 2*time.Minute, &issued)
+	defer hs.Close()
+
+	ts, err := gh.NewAppTokenSource(context.Background(), hs.Client(), hs.URL, "12345", "42", keyPEM)
+	assert.Nil(t, err)
+
+	token, err := ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "ghs_1", token.AccessToken)
+
+	// about to expire, so it's refreshed
+	token, err = ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "ghs_2", token.AccessToken)
+}
+
+func TestAppTokenSourceWrongKey(t *testing.T) {
+	key, _ := newTestKey(t)
+	_, otherKeyPEM := newTestKey(t)
+
+	issued := 0
+	hs := newFakeTokenEndpoint(t, key, time.Hour, &issued)
+	defer hs.Close()
+
+	ts, err := gh.NewAppTokenSource(context.Background(), hs.Client(), hs.URL, "12345", "42", otherKeyPEM)
+	assert.Nil(t, err)
+
+	_, err = ts.Token()
+	assert.NotNil(t, err)
+}
+
+func TestNewAppTokenSourceInvalid(t *testing.T) {
+	_, keyPEM := newTestKey(t)
+
+	_, err := gh.NewAppTokenSource(nil, nil, "", "app", "42", keyPEM)
+	assert.NotNil(t, err)
+
+	_, err = gh.NewAppTokenSource(nil, nil, "", "12345", "", keyPEM)
+	assert.NotNil(t, err)
+
+	_, err = gh.NewAppTokenSource(nil, nil, "", "12345", "42", "not a key")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,92 @@
+package gh
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// cacheEntry is a cached github api response, NextPage is kept as a 304 does not have to carry the Link header
+type cacheEntry struct {
+	etag     string
+	body     []byte
+	nextPage int
+}
+
+// etagCache holds the last response of each request made through getCached, keyed by path, e.g. one entry per org
+// and page; github does not count a 304 Not Modified against the rate limit, so an unchanged org costs nothing but
+// time. Entries that were not used during the last discovery cycle are dropped by sweep, so repos that went away
+// don't keep their entries forever
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	used    map[string]bool
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{entries: map[string]cacheEntry{}, used: map[string]bool{}}
+}
+
+func (c *etagCache) get(path string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	c.used[path] = true
+	return entry, ok
+}
+
+func (c *etagCache) set(path string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = entry
+	c.used[path] = true
+}
+
+// sweep drops the entries that were not used since the last sweep
+func (c *etagCache) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path := range c.entries {
+		if !c.used[path] {
+			delete(c.entries, path)
+		}
+	}
+	c.used = map[string]bool{}
+}
+
+// getCached is get with a conditional request, the cached body is decoded into v when github answers 304
+func (gh *GH) getCached(path string, v interface{}) (*github.Response, error) {
+
+	req, err := gh.client.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeTopicsPreview)
+
+	cached, ok := gh.cache.get(path)
+	if ok {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	var body bytes.Buffer
+	resp, err := gh.client.Do(gh.ctx, req, &body)
+	gh.budget.observe(resp, err)
+
+	// go-github treats anything but a 2xx as an error
+	if ok && resp != nil && resp.StatusCode == http.StatusNotModified {
+		resp.NextPage = cached.nextPage
+		return resp, json.Unmarshal(cached.body, v)
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		gh.cache.set(path, cacheEntry{etag: etag, body: body.Bytes(), nextPage: resp.NextPage})
+	}
+
+	return resp, json.Unmarshal(body.Bytes(), v)
+}
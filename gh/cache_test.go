@@ -0,0 +1,119 @@
+package gh_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReposNotModified(t *testing.T) {
+	requests := map[string]int{}
+	notModified := 0
+
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("page")
+			requests[page]++
+
+			etag := fmt.Sprintf(`"page-%s"`, page)
+			if r.Header.Get("If-None-Match") == etag {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+
+			switch page {
+			case "1":
+				w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/myorg/repos?per_page=1&page=2>; rel="next"`, "http://"+r.Host))
+				fmt.Fprintf(w, `[{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]}]`)
+			case "2":
+				fmt.Fprintf(w, `[{"name": "two", "full_name": "myorg/two", "topics": ["ci-gocd"]}]`)
+			default:
+				t.Fatalf("unexpected page %s", page)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubPerPage":    "1",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		repos, err := c.Repos()
+		assert.Nil(t, err)
+		if assert.Len(t, repos, 2) {
+			assert.Equal(t, "one", *repos[0].Name)
+			assert.Equal(t, "two", *repos[1].Name)
+		}
+	}
+
+	// the second run was served from the cache, and still followed the pages
+	assert.Equal(t, map[string]int{"1": 2, "2": 2}, requests)
+	assert.Equal(t, 2, notModified)
+}
+
+func TestCacheSweep(t *testing.T) {
+	conditional := map[string]int{}
+
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") != "" {
+				conditional[r.URL.Path]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+
+			switch r.URL.Path {
+			case "/orgs/myorg/repos":
+				fmt.Fprintf(w, `[{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]}]`)
+			case "/repos/myorg/one/contents/.gocd-seeder.yaml":
+				fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": "e30="}`)
+			default:
+				t.Fatalf("unexpected path %s", r.URL.Path)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+	repo := &source.Repository{FullName: "myorg/one", DefaultBranch: "master"}
+
+	// the file is fetched in the first cycle, but not in the second
+	for _, fetch := range []bool{true, false, true} {
+		_, err := c.Repos()
+		assert.Nil(t, err)
+		if fetch {
+			_, found, err := c.FetchFile(repo, ".gocd-seeder.yaml")
+			assert.Nil(t, err)
+			assert.True(t, found)
+		}
+	}
+
+	// the org listing is used every cycle and stays cached, the file's entry was dropped after the second cycle
+	assert.Equal(t, map[string]int{"/orgs/myorg/repos": 2}, conditional)
+}
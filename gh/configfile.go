@@ -0,0 +1,164 @@
+package gh
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// HasConfigFile implements Githubber and checks the repo's branch (see source.Repository.Ref) for a file that matches the config file
+// pattern, see source.MatchConfigFile
+func (gh *GH) HasConfigFile(repo *source.Repository) (bool, error) {
+
+	owner, name := splitFullName(repo.FullName)
+
+	branch := repo.Ref()
+	if branch == "" {
+		branch = "master"
+	}
+
+	// go-github puts the ref into the path as is, feature/x would be read as the tree x of the ref feature
+	tree, resp, err := gh.client.Git.GetTree(gh.ctx, owner, name, url.PathEscape(branch), true)
+	gh.budget.observe(resp, err)
+	if err != nil {
+		// github returns a 409 Conflict for empty repos, so there's no file either
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "unable to get tree of %s (%s): %v", repo.FullName, branch, status(resp))
+	}
+
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "blob" {
+			continue
+		}
+
+		if source.MatchConfigFile(repo.ConfigFilePattern(gh.ConfigFilePattern), entry.GetPath()) {
+			return true, nil
+		}
+	}
+
+	// github only returns part of the tree of very large repos, we can't tell so don't block the repo
+	if tree.GetTruncated() {
+		level.Debug(gh.logger).Log("msg", "tree of "+repo.FullName+" was truncated, assuming it has a config file")
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// FetchFile implements Githubber and returns the content of a file in the repo's default branch; the request is
+// conditional, so a file that did not change does not count against the rate limit
+func (gh *GH) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+
+	owner, name := splitFullName(repo.FullName)
+
+	branch := repo.DefaultBranch
+	if branch == "" {
+		branch = "master"
+	}
+
+	var content github.RepositoryContent
+	resp, err := gh.getCached(fmt.Sprintf("repos/%s/%s/contents/%s?ref=%s", owner, name, file, url.QueryEscape(branch)), &content)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to get %s of %s (%s): %v", file, repo.FullName, branch, status(resp))
+	}
+
+	// e.g. a directory or a submodule with the file's name
+	if content.GetType() != "file" {
+		return nil, false, nil
+	}
+
+	decoded, err := content.GetContent()
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to decode %s of %s", file, repo.FullName)
+	}
+
+	return []byte(decoded), true, nil
+}
+
+// Branches implements Githubber and returns the names of the repo's branches
+func (gh *GH) Branches(repo *source.Repository) ([]string, error) {
+
+	owner, name := splitFullName(repo.FullName)
+
+	var names []string
+	page := 1
+	for {
+
+		if err := gh.ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "stopped listing github branches")
+		}
+
+		var branches []*github.Branch
+		resp, err := gh.getCached(fmt.Sprintf("repos/%s/%s/branches?per_page=%d&page=%d", owner, name, gh.PerPage, page), &branches)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get branches of %s: %v", repo.FullName, status(resp))
+		}
+
+		for _, branch := range branches {
+			names = append(names, branch.GetName())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	return names, nil
+}
+
+// PullRequests implements Githubber and returns the repo's open pull requests; pull requests from forks are left out,
+// GoCD would run whatever pipelines anybody who can fork the repo puts into them
+func (gh *GH) PullRequests(repo *source.Repository) ([]source.PullRequest, error) {
+
+	owner, name := splitFullName(repo.FullName)
+
+	var prs []source.PullRequest
+	page := 1
+	for {
+
+		if err := gh.ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "stopped listing github pull requests")
+		}
+
+		var pulls []*github.PullRequest
+		resp, err := gh.getCached(fmt.Sprintf("repos/%s/%s/pulls?state=open&per_page=%d&page=%d", owner, name, gh.PerPage, page), &pulls)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get pull requests of %s: %v", repo.FullName, status(resp))
+		}
+
+		for _, pull := range pulls {
+			if !strings.EqualFold(pull.GetHead().GetRepo().GetFullName(), repo.FullName) {
+				continue
+			}
+			prs = append(prs, source.PullRequest{Number: pull.GetNumber(), Branch: pull.GetHead().GetRef()})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	return prs, nil
+}
+
+// splitFullName splits <owner>/<repo> into owner and repo
+func splitFullName(fullName string) (string, string) {
+	i := strings.Index(fullName, "/")
+	if i < 0 {
+		return "", fullName
+	}
+	return fullName[:i], fullName[i+1:]
+}
@@ -0,0 +1,212 @@
+package gh_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasConfigFile(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.EscapedPath() {
+			case "/repos/myorg/configured/git/trees/main":
+				assert.Equal(t, "1", r.URL.Query().Get("recursive"))
+				fmt.Fprintf(w, `{"sha": "abc", "tree": [
+					{"path": "README.md", "type": "blob"},
+					{"path": "ci", "type": "tree"},
+					{"path": "ci/ci.gocd.yaml", "type": "blob"}
+				]}`)
+			case "/repos/myorg/unconfigured/git/trees/master":
+				fmt.Fprintf(w, `{"sha": "abc", "tree": [
+					{"path": "README.md", "type": "blob"},
+					{"path": "ci.gocd.yml", "type": "blob"}
+				]}`)
+			case "/repos/myorg/pr/git/trees/feature%2Fx":
+				// a ref with a "/" is a single path segment
+				fmt.Fprintf(w, `{"sha": "abc", "tree": [{"path": "ci.gocd.yaml", "type": "blob"}]}`)
+			case "/repos/myorg/empty/git/trees/master":
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprintf(w, `{"message": "Git Repository is empty."}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch": "myorg",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	var hasConfigFileTests = []struct {
+		name       string
+		repo       *source.Repository
+		configured bool
+		err        bool
+	}{
+		{
+			name:       "configured",
+			repo:       &source.Repository{FullName: "myorg/configured", DefaultBranch: "main"},
+			configured: true,
+		},
+		{
+			name:       "unconfigured",
+			repo:       &source.Repository{FullName: "myorg/unconfigured"},
+			configured: false,
+		},
+		{
+			name:       "branch_with_slash",
+			repo:       &source.Repository{FullName: "myorg/pr", DefaultBranch: "main", Branch: "feature/x", Variant: "pr-1"},
+			configured: true,
+		},
+		{
+			name:       "empty",
+			repo:       &source.Repository{FullName: "myorg/empty"},
+			configured: false,
+		},
+		{
+			name: "missing",
+			repo: &source.Repository{FullName: "myorg/missing"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range hasConfigFileTests {
+		t.Run(tt.name, func(t *testing.T) {
+			configured, err := c.HasConfigFile(tt.repo)
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.configured, configured)
+		})
+	}
+}
+
+func TestFetchFile(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/repos/myorg/overridden/contents/.gocd-seeder.yaml":
+				assert.Equal(t, "main", r.URL.Query().Get("ref"))
+				// "branch: dev\n"
+				fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": "YnJhbmNoOiBkZXYK"}`)
+			case "/repos/myorg/directory/contents/.gocd-seeder.yaml":
+				fmt.Fprintf(w, `{"type": "dir"}`)
+			case "/repos/myorg/broken/contents/.gocd-seeder.yaml":
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch": "myorg",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	var fetchFileTests = []struct {
+		name    string
+		repo    *source.Repository
+		content string
+		found   bool
+		err     bool
+	}{
+		{name: "overridden", repo: &source.Repository{FullName: "myorg/overridden", DefaultBranch: "main"}, content: "branch: dev\n", found: true},
+		{name: "directory", repo: &source.Repository{FullName: "myorg/directory"}},
+		{name: "missing", repo: &source.Repository{FullName: "myorg/missing"}},
+		{name: "broken", repo: &source.Repository{FullName: "myorg/broken"}, err: true},
+	}
+
+	for _, tt := range fetchFileTests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, found, err := c.FetchFile(tt.repo, source.OverridesFile)
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.content, string(content))
+		})
+	}
+}
+
+func TestBranches(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/repos/myorg/service/branches":
+				if r.URL.Query().Get("page") == "2" {
+					fmt.Fprintf(w, `[{"name": "release/2.x"}]`)
+					return
+				}
+				w.Header().Set("Link", fmt.Sprintf(`<%s/repos/myorg/service/branches?page=2>; rel="next"`, "http://"+r.Host))
+				fmt.Fprintf(w, `[{"name": "main"}, {"name": "release/1.x"}]`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch": "myorg",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	branches, err := c.Branches(&source.Repository{FullName: "myorg/service"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"main", "release/1.x", "release/2.x"}, branches)
+
+	_, err = c.Branches(&source.Repository{FullName: "myorg/missing"})
+	assert.NotNil(t, err)
+}
+
+func TestPullRequests(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/repos/myorg/previews/pulls":
+				assert.Equal(t, "open", r.URL.Query().Get("state"))
+				fmt.Fprintf(w, `[
+					{"number": 42, "head": {"ref": "feature/x", "repo": {"full_name": "myorg/previews"}}},
+					{"number": 43, "head": {"ref": "main", "repo": {"full_name": "someone/previews"}}},
+					{"number": 44, "head": {"ref": "gone", "repo": null}}
+				]`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch": "myorg",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	prs, err := c.PullRequests(&source.Repository{FullName: "myorg/previews"})
+	assert.Nil(t, err)
+	assert.Equal(t, []source.PullRequest{{Number: 42, Branch: "feature/x"}}, prs)
+}
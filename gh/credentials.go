@@ -0,0 +1,47 @@
+package gh
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CredentialsNone leaves GoCD to clone repos w/o credentials, e.g. public repos, the default
+	CredentialsNone = "none"
+	// CredentialsSeeder makes GoCD clone repos with the seeder's own token, or its app's installation token
+	CredentialsSeeder = "seeder"
+	// CredentialsToken makes GoCD clone repos with a token of its own, e.g. a bot's with read access only
+	CredentialsToken = "token"
+)
+
+// materialUsername is the username that goes with a token, github requires it for app installation tokens and
+// ignores it for any other token
+const materialUsername = "x-access-token"
+
+// Credentials returns the username and password GoCD clones repos with over https, empty for CredentialsNone; app
+// installation tokens are refreshed before they expire, so the password changes
+func (gh *GH) Credentials() (string, string, error) {
+
+	switch gh.MaterialCredentials {
+	case CredentialsSeeder:
+		token, err := gh.tokens.Token()
+		if err != nil {
+			return "", "", errors.Wrap(err, "unable to get github token")
+		}
+		return materialUsername, token.AccessToken, nil
+
+	case CredentialsToken:
+		if gh.materialTokenPath == "" {
+			return materialUsername, gh.materialToken, nil
+		}
+		token, err := ioutil.ReadFile(gh.materialTokenPath)
+		if err != nil {
+			return "", "", errors.Wrap(err, "unable to read github material token")
+		}
+		return materialUsername, strings.TrimSpace(string(token)), nil
+	}
+
+	return "", "", nil
+}
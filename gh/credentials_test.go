@@ -0,0 +1,64 @@
+package gh_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "material_token")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("bot-token-1\n"), 0600))
+
+	var credentialsTests = []struct {
+		name     string
+		config   map[string]string
+		username string
+		password string
+		err      bool
+	}{
+		{name: "default", config: map[string]string{}},
+		{name: "none", config: map[string]string{"GithubMaterialCredentials": "none", "GithubAPIKey": "seeder-token"}},
+		{name: "seeder", config: map[string]string{"GithubMaterialCredentials": "seeder", "GithubAPIKey": "seeder-token"}, username: "x-access-token", password: "seeder-token"},
+		{name: "seeder_without_token", config: map[string]string{"GithubMaterialCredentials": "seeder"}, err: true},
+		{name: "token", config: map[string]string{"GithubMaterialCredentials": "token", "GithubMaterialToken": "bot-token"}, username: "x-access-token", password: "bot-token"},
+		{name: "token_file", config: map[string]string{"GithubMaterialCredentials": "token", "GithubMaterialToken": "bot-token", "GithubMaterialTokenPath": tokenFile}, username: "x-access-token", password: "bot-token-1"},
+		{name: "token_missing", config: map[string]string{"GithubMaterialCredentials": "token"}, err: true},
+		{name: "invalid", config: map[string]string{"GithubMaterialCredentials": "basic"}, err: true},
+	}
+
+	for _, tt := range credentialsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config["GithubOrgMatch"] = "gooflix"
+			c, err := gh.New(context.Background(), tt.config, log.NewNopLogger(), github.NewClient(nil))
+			assert.Equal(t, tt.err, err != nil)
+			if err != nil {
+				return
+			}
+
+			username, password, err := c.(*gh.GH).Credentials()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.username, username)
+			assert.Equal(t, tt.password, password)
+		})
+	}
+
+	// a rotated token file is picked up
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("bot-token-2\n"), 0600))
+	c, err := gh.New(context.Background(), map[string]string{"GithubOrgMatch": "gooflix", "GithubMaterialCredentials": "token", "GithubMaterialTokenPath": tokenFile}, log.NewNopLogger(), github.NewClient(nil))
+	assert.Nil(t, err)
+	_, password, err := c.(*gh.GH).Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "bot-token-2", password)
+}
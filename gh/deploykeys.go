@@ -0,0 +1,68 @@
+package gh
+
+import (
+	"net/http"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// AddDeployKey implements deploykey.Keyer
+func (gh *GH) AddDeployKey(repo *source.Repository, title string, publicKey string) error {
+
+	owner, name := splitFullName(repo.FullName)
+
+	_, resp, err := gh.client.Repositories.CreateKey(gh.ctx, owner, name, &github.Key{
+		Title:    github.String(title),
+		Key:      github.String(publicKey),
+		ReadOnly: github.Bool(true),
+	})
+	gh.budget.observe(resp, err)
+	if err != nil {
+		return errors.Wrapf(err, "unable to add deploy key to %s: %v", repo.FullName, status(resp))
+	}
+
+	return nil
+}
+
+// RemoveDeployKeys implements deploykey.Keyer
+func (gh *GH) RemoveDeployKeys(fullName string, title string) error {
+
+	owner, name := splitFullName(fullName)
+
+	var remove []int64
+	opt := &github.ListOptions{PerPage: gh.PerPage}
+	for {
+
+		keys, resp, err := gh.client.Repositories.ListKeys(gh.ctx, owner, name, opt)
+		gh.budget.observe(resp, err)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to list deploy keys of %s: %v", fullName, status(resp))
+		}
+
+		for _, key := range keys {
+			if key.GetTitle() == title {
+				remove = append(remove, key.GetID())
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	for _, id := range remove {
+		resp, err := gh.client.Repositories.DeleteKey(gh.ctx, owner, name, id)
+		gh.budget.observe(resp, err)
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return errors.Wrapf(err, "unable to remove deploy key %d of %s: %v", id, fullName, status(resp))
+		}
+	}
+
+	return nil
+}
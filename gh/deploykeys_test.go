@@ -0,0 +1,60 @@
+package gh_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployKeys(t *testing.T) {
+	var deleted []string
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPost && r.URL.Path == "/repos/gooflix/one/keys":
+				var key map[string]interface{}
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&key))
+				assert.Equal(t, "gocd-seeder gooflix-one", key["title"])
+				assert.Equal(t, true, key["read_only"])
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"id": 3}`)
+			case r.Method == http.MethodGet && r.URL.Path == "/repos/gooflix/one/keys":
+				fmt.Fprintf(w, `[{"id": 1, "title": "gocd-seeder gooflix-one"}, {"id": 2, "title": "someone's laptop"}]`)
+			case r.Method == http.MethodDelete:
+				deleted = append(deleted, r.URL.Path)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch": "gooflix",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	err = c.(*gh.GH).AddDeployKey(&source.Repository{FullName: "gooflix/one"}, "gocd-seeder gooflix-one", "ssh-ed25519 AAAA")
+	assert.Nil(t, err)
+
+	err = c.(*gh.GH).RemoveDeployKeys("gooflix/one", "gocd-seeder gooflix-one")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/repos/gooflix/one/keys/1"}, deleted)
+
+	// the repo is gone, and so are its keys
+	err = c.(*gh.GH).RemoveDeployKeys("gooflix/gone", "gocd-seeder gooflix-gone")
+	assert.Nil(t, err)
+}
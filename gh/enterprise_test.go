@@ -0,0 +1,93 @@
+package gh_test
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnterpriseWithCABundle(t *testing.T) {
+	hs := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/v3/orgs/myorg/repos", r.URL.Path)
+			assert.Equal(t, "Bearer aabbcc", r.Header.Get("Authorization"))
+			fmt.Fprintf(w, `[{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"], "clone_url": "https://github.example.com/myorg/one.git"}]`)
+		}))
+	defer hs.Close()
+
+	caBundle, err := ioutil.TempFile("", "ca-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caBundle.Name())
+	pem.Encode(caBundle, &pem.Block{Type: "CERTIFICATE", Bytes: hs.Certificate().Raw})
+	caBundle.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubAPIKey":     "aabbcc",
+			"GithubBaseURL":    hs.URL,
+			"GithubCABundle":   caBundle.Name(),
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+	assert.Nil(t, err)
+
+	repos, _, err := c.OrgRepos("myorg")
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 1) {
+		assert.Equal(t, "https://github.example.com/myorg/one.git", repos[0].GetCloneURL())
+	}
+}
+
+func TestEnterpriseWithoutCABundle(t *testing.T) {
+	hs := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `[]`)
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubAPIKey":   "aabbcc",
+			"GithubBaseURL":  hs.URL,
+			"GithubOrgMatch": "myorg",
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+	assert.Nil(t, err)
+
+	// the server's certificate is not trusted
+	_, _, err = c.OrgRepos("myorg")
+	assert.NotNil(t, err)
+}
+
+func TestNewInvalidCABundle(t *testing.T) {
+	g, err := gh.New(
+		nil,
+		map[string]string{
+			"GithubAPIKey":   "aabbcc",
+			"GithubCABundle": "/dev/null",
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, g)
+}
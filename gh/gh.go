@@ -2,8 +2,20 @@ package gh
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/alex-leonhardt/gocd-seeder/source"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/google/go-github/github"
@@ -11,23 +23,87 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// discovery modes, list walks all repos of the org, search asks the github search api for repos with the topic,
+// graphql walks all repos of the org like list, using the graphql api
+const (
+	DiscoveryList    = "list"
+	DiscoverySearch  = "search"
+	DiscoveryGraphQL = "graphql"
+)
+
+// maxSearchResults is the maximum number of results the github search api will ever return for a query
+const maxSearchResults = 1000
+
+// DefaultTopic is the topic repos must carry when no topic expression was configured
+const DefaultTopic = "ci-gocd"
+
+// mediaTypeTopicsPreview is needed to retrieve the topics of repos
+const mediaTypeTopicsPreview = "application/vnd.github.mercy-preview+json"
+
+// DefaultPerPage is the page size used when listing repos, 100 is the maximum GitHub allows
+const DefaultPerPage = 100
+
 // GH is GitHub
 type GH struct {
-	APIKey     string
-	OrgMatch   string
-	TopicMatch string
-	client     *github.Client
-	ctx        context.Context
-	logger     log.Logger
+	APIKey            string
+	Orgs              []Org
+	TopicMatch        string
+	PerPage           int
+	Discovery         string
+	ConfigFilePattern string
+	Teams             []string
+	// MaterialCredentials is what GoCD clones repos over https with, see CredentialsNone, ...
+	MaterialCredentials string
+	materialToken       string
+	materialTokenPath   string
+	tokens              oauth2.TokenSource
+	topics              TopicExpr
+	names               *NameMatcher
+	policies            Policies
+	cache               *etagCache
+	budget              *rateBudget
+	owners              map[string]string
+	ownersMu            sync.Mutex
+	client              *github.Client
+	ctx                 context.Context
+	logger              log.Logger
 }
 
-// Githubber provides funcs to retrieve Github repositories
+// Githubber provides funcs to retrieve Github repositories; anything beyond discovery, e.g. deploy keys or webhooks,
+// is provided by *GH itself
 type Githubber interface {
 	Repos() ([]*github.Repository, error)
+	OrgRepos(string) ([]*github.Repository, []*github.Repository, error)
+	HasConfigFile(*source.Repository) (bool, error)
+	FetchFile(*source.Repository, string) ([]byte, bool, error)
+	Branches(*source.Repository) ([]string, error)
+	PullRequests(*source.Repository) ([]source.PullRequest, error)
 }
 
-// NewClient returns a new initialized GH client, context and error
+// repository adds the fields go-github does not know about (yet) to a github.Repository
+type repository struct {
+	*github.Repository
+	Disabled   *bool `json:"disabled,omitempty"`
+	IsTemplate *bool `json:"is_template,omitempty"`
+}
+
+// repositoriesSearchResult is a github.RepositoriesSearchResult using our repository
+type repositoriesSearchResult struct {
+	Total             *int          `json:"total_count,omitempty"`
+	IncompleteResults *bool         `json:"incomplete_results,omitempty"`
+	Repositories      []*repository `json:"items,omitempty"`
+}
+
+// NewClient returns a new initialized GH client, context and error; it authenticates as a Github App
+// installation when an app id is set, else it uses the api key; when a base url is set, it returns a client
+// for Github Enterprise Server
 func NewClient(ctx context.Context, config map[string]string) (*github.Client, context.Context, error) {
+	client, _, ctx, err := newClient(ctx, config)
+	return client, ctx, err
+}
+
+// newClient is NewClient, it also returns the token source the client authenticates with
+func newClient(ctx context.Context, config map[string]string) (*github.Client, oauth2.TokenSource, context.Context, error) {
 
 	APIKey := config["GithubAPIKey"]
 	if ctx == nil {
@@ -35,98 +111,501 @@ func NewClient(ctx context.Context, config map[string]string) (*github.Client, c
 	}
 
 	var err error
+	var ts oauth2.TokenSource
 
-	// cannot call github w/o api key
-	if APIKey == "" {
-		return nil, nil, errors.Wrap(errors.New("missing github api key"), "environment variable not set")
+	hc, err := newHTTPClient(config["GithubCABundle"])
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "unable to create http client")
 	}
 
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: APIKey},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	switch {
+	case config["GithubAppID"] != "":
+		ts, err = NewAppTokenSource(ctx, hc, config["GithubBaseURL"], config["GithubAppID"], config["GithubAppInstallationID"], config["GithubAppPrivateKey"])
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "unable to authenticate as github app")
+		}
+	case APIKey != "":
+		ts = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: APIKey},
+		)
+	default:
+		// cannot call github w/o api key
+		return nil, nil, nil, errors.Wrap(errors.New("missing github api key"), "environment variable not set")
+	}
 
-	return client, ctx, err
+	// oauth2 uses the http client from the context to do the actual requests
+	tc := oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, hc), ts)
+
+	client, err := newGithubClient(tc, config["GithubBaseURL"], config["GithubUploadURL"])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return client, ts, ctx, err
+
+}
+
+// newGithubClient returns a client for github.com, or for Github Enterprise Server when a base url is set, e.g.
+// https://github.example.com; the upload url defaults to the base url's /api/uploads/
+func newGithubClient(hc *http.Client, baseURL string, uploadURL string) (*github.Client, error) {
+
+	if baseURL == "" {
+		return github.NewClient(hc), nil
+	}
+
+	// the api of Github Enterprise Server lives at /api/v3/, uploads go to /api/uploads/
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/api/v3") {
+		baseURL += "/api/v3"
+	}
+
+	if uploadURL == "" {
+		uploadURL = strings.TrimSuffix(baseURL, "/api/v3") + "/api/uploads"
+	}
+
+	client, err := github.NewEnterpriseClient(baseURL, uploadURL, hc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid github enterprise url %s", baseURL)
+	}
+
+	return client, nil
+}
+
+// newHTTPClient returns an http client that trusts the certificates in the (PEM encoded) CA bundle in addition to
+// the system's, e.g. for a Github Enterprise Server using certificates signed by an internal CA
+func newHTTPClient(caBundle string) (*http.Client, error) {
+
+	if caBundle == "" {
+		return http.DefaultClient, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	certs, err := ioutil.ReadFile(caBundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read ca bundle")
+	}
+	if !pool.AppendCertsFromPEM(certs) {
+		return nil, fmt.Errorf("no certificates found in ca bundle %s", caBundle)
+	}
 
+	// the same settings as http.DefaultTransport, which can't be copied w/o Transport.Clone (go 1.13)
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{RootCAs: pool},
+	}
+
+	return &http.Client{Transport: transport}, nil
 }
 
 // New returns a configured GH struct, it uses NewClient if no *github.Client was passed
 func New(ctx context.Context, config map[string]string, logger log.Logger, client *github.Client) (Githubber, error) {
 
 	var err error
+	var tokens oauth2.TokenSource
 
 	if client == nil {
-		client, ctx, err = NewClient(ctx, config)
+		client, tokens, ctx, err = newClient(ctx, config)
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to create github client")
 		}
+	} else if config["GithubAPIKey"] != "" {
+		tokens = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config["GithubAPIKey"]})
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	perPage := DefaultPerPage
+	if config["GithubPerPage"] != "" {
+		perPage, err = strconv.Atoi(config["GithubPerPage"])
+		if err != nil || perPage < 1 || perPage > 100 {
+			return nil, fmt.Errorf("invalid github page size %q, must be between 1 and 100", config["GithubPerPage"])
+		}
+	}
+
+	orgs, err := ParseOrgs(config["GithubOrgMatch"])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid github orgs")
+	}
+
+	topicMatch := config["GithubTopicMatch"]
+	if topicMatch == "" {
+		topicMatch = DefaultTopic
+	}
+
+	// parse the expression once, it's evaluated against every repo's topics
+	topics, err := ParseTopicExpr(topicMatch)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid github topic")
+	}
+
+	names, err := NewNameMatcher(config["GithubInclude"], config["GithubExclude"])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid github include/exclude patterns")
+	}
+
+	configFilePattern := config["GithubConfigFilePattern"]
+	if configFilePattern == "" {
+		configFilePattern = source.DefaultConfigFilePattern
+	}
+	if _, err := path.Match(configFilePattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file pattern %s", configFilePattern)
+	}
+
+	// teams belong to an org, the authenticated user's repos have none
+	teams := ParseTeams(config["GithubTeams"])
+	for _, org := range orgs {
+		if len(teams) > 0 && org.Name == "" {
+			return nil, errors.New("github teams require an org")
+		}
+	}
+
+	reserve := DefaultRateLimitReserve
+	if config["GithubRateLimitReserve"] != "" {
+		reserve, err = strconv.Atoi(config["GithubRateLimitReserve"])
+		if err != nil || reserve < 0 {
+			return nil, fmt.Errorf("invalid github rate limit reserve %q, must be 0 or more", config["GithubRateLimitReserve"])
+		}
+	}
+
+	policies, err := ParsePolicies(config["GithubRepoPolicy"])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid github repo policy")
+	}
+
+	credentials := config["GithubMaterialCredentials"]
+	switch credentials {
+	case "":
+		credentials = CredentialsNone
+	case CredentialsNone:
+	case CredentialsSeeder:
+		if tokens == nil {
+			return nil, errors.New("github material credentials of the seeder require an api key or an app")
+		}
+	case CredentialsToken:
+		if config["GithubMaterialToken"] == "" && config["GithubMaterialTokenPath"] == "" {
+			return nil, errors.New("missing github material token")
+		}
+	default:
+		return nil, fmt.Errorf("invalid github material credentials %q, must be one of: %s, %s, %s", credentials, CredentialsNone, CredentialsSeeder, CredentialsToken)
+	}
+
+	discovery := config["GithubDiscovery"]
+	switch discovery {
+	case "":
+		discovery = DiscoveryList
+	case DiscoveryList:
+	case DiscoverySearch:
+		// searching w/o an org would search all of github
+		for _, org := range orgs {
+			if org.Name == "" {
+				return nil, errors.New("github search discovery requires an org")
+			}
+		}
+		// we search for each topic that's not negated, which does not find repos without topics
+		if topics.Match(nil) {
+			return nil, fmt.Errorf("topic expression %q matches repos without topics, which github search discovery cannot find", topicMatch)
+		}
+	case DiscoveryGraphQL:
+		// the graphql api has no equivalent of listing the authenticated user's repos
+		for _, org := range orgs {
+			if org.Name == "" {
+				return nil, errors.New("github graphql discovery requires an org")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid github discovery mode %q, must be one of: %s, %s, %s", discovery, DiscoveryList, DiscoverySearch, DiscoveryGraphQL)
 	}
 
 	return &GH{
-		APIKey:     config["GithubAPIKey"],
-		OrgMatch:   config["GithubOrgMatch"],
-		TopicMatch: config["GithubTopicMatch"],
-		logger:     logger,
-		client:     client,
-		ctx:        ctx,
+		APIKey:              config["GithubAPIKey"],
+		Orgs:                orgs,
+		TopicMatch:          topicMatch,
+		PerPage:             perPage,
+		Discovery:           discovery,
+		topics:              topics,
+		names:               names,
+		policies:            policies,
+		Teams:               teams,
+		owners:              map[string]string{},
+		cache:               newETagCache(),
+		budget:              newRateBudget(reserve),
+		ConfigFilePattern:   configFilePattern,
+		MaterialCredentials: credentials,
+		materialToken:       config["GithubMaterialToken"],
+		materialTokenPath:   config["GithubMaterialTokenPath"],
+		tokens:              tokens,
+		logger:              logger,
+		client:              client,
+		ctx:                 ctx,
 	}, nil
 }
 
-// Repos implements Githubber Github repositories that we'd like to create GoCD config repos for
+// Repos implements Githubber Github repositories that we'd like to create GoCD config repos for, across all orgs
 func (gh *GH) Repos() ([]*github.Repository, error) {
 
+	var foundRepos = make([]*github.Repository, 0)
+
+	for _, org := range gh.Orgs {
+		repos, _, err := gh.OrgRepos(org.Name)
+		if err != nil {
+			return nil, err
+		}
+		foundRepos = append(foundRepos, repos...)
+	}
+
+	return foundRepos, nil
+}
+
+// OrgRepos implements Githubber Github repositories of a single org that we'd like to create GoCD config repos for;
+// it also returns the repos that were skipped by policy, their existing config repos must be kept
+func (gh *GH) OrgRepos(org string) ([]*github.Repository, []*github.Repository, error) {
+
 	// make sure foundRepos is not nil
 	var foundRepos = make([]*github.Repository, 0)
-	var repos []*github.Repository
+	var skippedRepos = make([]*github.Repository, 0)
+	var repos []*repository
 	var err error
-	var resp *github.Response
 
 	// protect against nil panic
 	if gh.client.Repositories == nil {
-		return nil, errors.Wrap(fmt.Errorf("nil pointer"), "unable to parse response from github")
+		return nil, nil, errors.Wrap(fmt.Errorf("nil pointer"), "unable to parse response from github")
+	}
+
+	// every discovery cycle starts with the first org, whatever the previous cycle didn't ask for is gone
+	if len(gh.Orgs) > 0 && gh.Orgs[0].Name == org {
+		gh.cache.sweep()
 	}
 
-	// get all repos
-	if gh.OrgMatch != "" {
-		repos, resp, err = gh.client.Repositories.ListByOrg(gh.ctx, gh.OrgMatch, nil)
+	switch gh.Discovery {
+	case DiscoverySearch:
+		repos, err = gh.searchRepos(org)
+	case DiscoveryGraphQL:
+		repos, err = gh.graphqlRepos(org)
+	default:
+		repos, err = gh.listRepos(org)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// only the teams' repos are of interest, if teams were set
+	var owners map[string]string
+	if len(gh.Teams) > 0 {
+		owners, err = gh.teamRepos(org)
 		if err != nil {
-			return nil, errors.Wrapf(err, "unable to get repos (ListByOrg): %v", resp.Response.Status)
+			return nil, nil, err
 		}
-	} else {
-		repos, resp, err = gh.client.Repositories.List(gh.ctx, "", nil)
-		if err != nil {
-			return nil, errors.Wrapf(err, "unable to get repos (List): %v", resp.Response.Status)
+	}
+
+	// filter out only the repos we're interested in and return the slice
+	for _, rr := range repos {
+
+		if owners != nil {
+			team, ok := owners[strings.ToLower(rr.GetFullName())]
+			if !ok {
+				continue
+			}
+			gh.setTeam(rr.GetFullName(), team)
+		}
+
+		switch gh.evaluate(rr) {
+		case PolicySeed:
+			foundRepos = append(foundRepos, rr.Repository)
+		case PolicySkip:
+			skippedRepos = append(skippedRepos, rr.Repository)
 		}
 	}
 
-	// return specific error when we hit the rate limit
-	if _, ok := err.(*github.RateLimitError); ok {
-		return nil, errors.Wrap(err, "github rate limit hit")
+	// return the repos we care about
+	return foundRepos, skippedRepos, nil
+}
+
+// evaluate decides whether a repo is seeded, skipped, or treated as removed; repos w/o a matching topic or that
+// are excluded by name are treated as removed too
+func (gh *GH) evaluate(rr *repository) string {
+
+	if !gh.topics.Match(rr.Topics) {
+		return PolicyRemove
 	}
 
-	// else just return the error
-	if err != nil {
-		return nil, errors.Wrap(err, "error listing github repos")
+	// repos with matching topics are candidates, which can still be excluded by name
+	included, reason := gh.names.Match(rr.GetFullName())
+	if !included {
+		level.Debug(gh.logger).Log("msg", "excluded repo: "+rr.GetFullName(), "reason", reason)
+		return PolicyRemove
 	}
 
-	// filter out only the repos we're interested in and return the slice
-	for _, rr := range repos {
+	switch policy, kind := gh.policies.apply(rr); policy {
+	case PolicyRemove:
+		level.Debug(gh.logger).Log("msg", "removed repo: "+rr.GetFullName(), "reason", "policy for "+kind+" repos")
+		return PolicyRemove
+	case PolicySkip:
+		level.Debug(gh.logger).Log("msg", "skipped repo: "+rr.GetFullName(), "reason", "policy for "+kind+" repos")
+		return PolicySkip
+	}
+
+	level.Debug(gh.logger).Log("msg", "found repo: "+rr.GetFullName(), "reason", reason)
+	return PolicySeed
+}
+
+// listRepos lists all repos of the org (or the authenticated user's repos if no org was set)
+func (gh *GH) listRepos(org string) ([]*repository, error) {
+
+	var repos []*repository
+
+	u := "user/repos"
+	if org != "" {
+		u = fmt.Sprintf("orgs/%s/repos", org)
+	}
+	page := 1
+
+	// get all repos, one page at a time, until github tells us there is no next page
+	for {
+
+		// stop paging when the context was cancelled (e.g. we're shutting down)
+		if err := gh.ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "stopped listing github repos")
+		}
+
+		var found []*repository
+
+		// listings rarely change between runs, so they are requested conditionally
+		resp, err := gh.getCached(fmt.Sprintf("%s?per_page=%d&page=%d", u, gh.PerPage, page), &found)
+
+		// return specific errors when we hit a rate limit, Delay tells when to try again
+		switch err.(type) {
+		case *github.RateLimitError:
+			return nil, errors.Wrap(err, "github rate limit hit")
+		case *github.AbuseRateLimitError:
+			return nil, errors.Wrap(err, "github secondary rate limit hit")
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get repos (%s): %v", u, status(resp))
+		}
+
+		repos = append(repos, found...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	return repos, nil
+}
+
+// searchRepos finds the repos that carry the topic using the github search api, this needs a lot less
+// api calls on large orgs compared to listing all repos, however, the search api has its own (lower) rate limit;
+// for topic expressions, each topic that is not negated is searched for and the results are merged
+func (gh *GH) searchRepos(org string) ([]*repository, error) {
+
+	var repos []*repository
+	seen := map[string]bool{}
+	searched := map[string]bool{}
 
-		// dont bother if there are no topics on the repo
-		if len(rr.Topics) > 0 {
+	for _, topic := range positiveTopics(gh.topics, false) {
 
-			// if we have > 0 topics, iterate over them until we have a match and add to the foundRepos slice
-			for _, topic := range rr.Topics {
-				if topic == gh.TopicMatch {
-					foundRepos = append(foundRepos, rr)
-					level.Debug(gh.logger).Log("msg", "found repo: "+*rr.FullName)
-				}
+		if searched[topic] {
+			continue
+		}
+		searched[topic] = true
+
+		found, err := gh.searchTopic(org, topic)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range found {
+			if !seen[repo.GetFullName()] {
+				seen[repo.GetFullName()] = true
+				repos = append(repos, repo)
 			}
 		}
+	}
+
+	return repos, nil
+}
+
+// searchTopic returns all repos of the org that carry the topic, following the search api's pagination
+func (gh *GH) searchTopic(org string, topic string) ([]*repository, error) {
+
+	var repos []*repository
+
+	query := fmt.Sprintf("topic:%s org:%s", topic, org)
+	page := 1
+
+	for {
+
+		if err := gh.ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "stopped searching github repos")
+		}
 
+		var result repositoriesSearchResult
+
+		resp, err := gh.get(fmt.Sprintf("search/repositories?q=%s&per_page=%d&page=%d", url.QueryEscape(query), gh.PerPage, page), &result)
+		switch err.(type) {
+		case *github.RateLimitError:
+			return nil, errors.Wrap(err, "github search rate limit hit")
+		case *github.AbuseRateLimitError:
+			return nil, errors.Wrap(err, "github secondary rate limit hit")
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to search repos (%s): %v", query, status(resp))
+		}
+
+		// a partial result would make us remove config repos that still exist, so don't use it at all
+		if result.IncompleteResults != nil && *result.IncompleteResults {
+			return nil, fmt.Errorf("incomplete search results from github for %q", query)
+		}
+		if result.Total != nil && *result.Total > maxSearchResults {
+			return nil, fmt.Errorf("github search for %q found %d repos, only the first %d can be retrieved", query, *result.Total, maxSearchResults)
+		}
+
+		repos = append(repos, result.Repositories...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
 	}
 
-	// return the repos we care about
-	return foundRepos, nil
+	return repos, nil
+}
+
+// get requests a github api path and decodes the response into v, we're not using the go-github services to
+// list repos as they do not decode all the fields we need (e.g. disabled, is_template)
+func (gh *GH) get(path string, v interface{}) (*github.Response, error) {
+
+	req, err := gh.client.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeTopicsPreview)
+
+	resp, err := gh.client.Do(gh.ctx, req, v)
+	gh.budget.observe(resp, err)
+
+	return resp, err
+}
+
+// status returns the http status of a github response, or an empty string if there was no response at all
+func status(resp *github.Response) string {
+	if resp == nil || resp.Response == nil {
+		return ""
+	}
+	return resp.Response.Status
 }
@@ -2,6 +2,10 @@ package gh_test
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
 
@@ -71,3 +75,284 @@ func TestRepos(t *testing.T) {
 	assert.IsType(t, []*github.Repository{}, repos)
 
 }
+
+// newTestClient returns a github client that talks to the given httptest server
+func newTestClient(hs *httptest.Server) *github.Client {
+	client := github.NewClient(hs.Client())
+	client.BaseURL, _ = url.Parse(hs.URL + "/")
+	return client
+}
+
+func TestNewInvalidPerPage(t *testing.T) {
+	g, err := gh.New(
+		nil,
+		map[string]string{
+			"GithubAPIKey":  "aabbcc",
+			"GithubPerPage": "1000",
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, g)
+}
+
+func TestReposPaginated(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/orgs/myorg/repos", r.URL.Path)
+			assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+
+			switch r.URL.Query().Get("page") {
+			case "", "1":
+				w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/myorg/repos?per_page=2&page=2>; rel="next"`, "http://"+r.Host))
+				fmt.Fprintf(w, `[{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]}, {"name": "two", "full_name": "myorg/two"}]`)
+			case "2":
+				fmt.Fprintf(w, `[{"name": "three", "full_name": "myorg/three", "topics": ["ci-gocd"]}]`)
+			default:
+				t.Fatalf("unexpected page %s", r.URL.Query().Get("page"))
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubPerPage":    "2",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, err := c.Repos()
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 2) {
+		assert.Equal(t, "one", *repos[0].Name)
+		assert.Equal(t, "three", *repos[1].Name)
+	}
+}
+
+func TestReposCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "2" {
+				t.Fatal("requested page 2 after the context was cancelled")
+			}
+			// cancel while we're still on the first page
+			cancel()
+			w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/myorg/repos?page=2>; rel="next"`, "http://"+r.Host))
+			fmt.Fprintf(w, `[{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]}]`)
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		ctx,
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, err := c.Repos()
+	assert.NotNil(t, err)
+	assert.Nil(t, repos)
+}
+
+func TestNewSearchWithoutOrg(t *testing.T) {
+	g, err := gh.New(
+		nil,
+		map[string]string{
+			"GithubAPIKey":    "aabbcc",
+			"GithubDiscovery": gh.DiscoverySearch,
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, g)
+}
+
+func TestReposSearch(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/search/repositories", r.URL.Path)
+			assert.Equal(t, "topic:ci-gocd org:myorg", r.URL.Query().Get("q"))
+
+			switch r.URL.Query().Get("page") {
+			case "", "1":
+				w.Header().Set("Link", fmt.Sprintf(`<%s/search/repositories?q=topic%%3Aci-gocd+org%%3Amyorg&page=2>; rel="next"`, "http://"+r.Host))
+				fmt.Fprintf(w, `{"total_count": 2, "incomplete_results": false, "items": [{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]}]}`)
+			case "2":
+				fmt.Fprintf(w, `{"total_count": 2, "incomplete_results": false, "items": [{"name": "two", "full_name": "myorg/two", "topics": ["ci-gocd"]}]}`)
+			default:
+				t.Fatalf("unexpected page %s", r.URL.Query().Get("page"))
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubDiscovery":  gh.DiscoverySearch,
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, err := c.Repos()
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 2) {
+		assert.Equal(t, "one", *repos[0].Name)
+		assert.Equal(t, "two", *repos[1].Name)
+	}
+}
+
+func TestReposSearchIncomplete(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"total_count": 2, "incomplete_results": true, "items": [{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]}]}`)
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubDiscovery":  gh.DiscoverySearch,
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, err := c.Repos()
+	assert.NotNil(t, err)
+	assert.Nil(t, repos)
+}
+
+func TestReposSearchRateLimit(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Limit", "30")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1541174400")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `{"message": "API rate limit exceeded for user ID 1."}`)
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubDiscovery":  gh.DiscoverySearch,
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	_, err = c.Repos()
+	assert.Regexp(t, "^github search rate limit hit", err)
+}
+
+func TestReposSearchTopicExpr(t *testing.T) {
+	var queries []string
+
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			queries = append(queries, r.URL.Query().Get("q"))
+
+			switch r.URL.Query().Get("q") {
+			case "topic:ci-gocd org:myorg":
+				fmt.Fprintf(w, `{"total_count": 2, "items": [{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]}, {"name": "two", "full_name": "myorg/two", "topics": ["ci-gocd", "gocd-pipelines", "deprecated"]}]}`)
+			case "topic:gocd-pipelines org:myorg":
+				fmt.Fprintf(w, `{"total_count": 2, "items": [{"name": "two", "full_name": "myorg/two", "topics": ["ci-gocd", "gocd-pipelines", "deprecated"]}, {"name": "three", "full_name": "myorg/three", "topics": ["gocd-pipelines"]}]}`)
+			default:
+				t.Fatalf("unexpected query %s", r.URL.Query().Get("q"))
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "(ci-gocd OR gocd-pipelines) AND NOT deprecated",
+			"GithubDiscovery":  gh.DiscoverySearch,
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, err := c.Repos()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"topic:ci-gocd org:myorg", "topic:gocd-pipelines org:myorg"}, queries)
+	if assert.Len(t, repos, 2) {
+		assert.Equal(t, "one", *repos[0].Name)
+		assert.Equal(t, "three", *repos[1].Name)
+	}
+}
+
+func TestNewSearchNegatedTopicExpr(t *testing.T) {
+	g, err := gh.New(
+		nil,
+		map[string]string{
+			"GithubAPIKey":     "aabbcc",
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "NOT deprecated",
+			"GithubDiscovery":  gh.DiscoverySearch,
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, g)
+}
+
+func TestReposExcluded(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `[
+				{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]},
+				{"name": "one-playground", "full_name": "myorg/one-playground", "topics": ["ci-gocd"]},
+				{"name": "tmp-two", "full_name": "myorg/tmp-two", "topics": ["ci-gocd"]}
+			]`)
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubExclude":    "*-playground,tmp-*",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, err := c.Repos()
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 1) {
+		assert.Equal(t, "one", *repos[0].Name)
+	}
+}
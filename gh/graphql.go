@@ -0,0 +1,188 @@
+package gh
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// graphqlRepositoriesQuery pages through an org's repos, fetching everything discovery needs in one go
+const graphqlRepositoriesQuery = `query($org: String!, $first: Int!, $cursor: String) {
+  organization(login: $org) {
+    repositories(first: $first, after: $cursor, orderBy: {field: NAME, direction: ASC}) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        databaseId
+        name
+        nameWithOwner
+        url
+        sshUrl
+        isArchived
+        isDisabled
+        isFork
+        isTemplate
+        isEmpty
+        defaultBranchRef {
+          name
+        }
+        repositoryTopics(first: 100) {
+          nodes {
+            topic {
+              name
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphqlRepository struct {
+	DatabaseID       int64  `json:"databaseId"`
+	Name             string `json:"name"`
+	NameWithOwner    string `json:"nameWithOwner"`
+	URL              string `json:"url"`
+	SSHURL           string `json:"sshUrl"`
+	IsArchived       bool   `json:"isArchived"`
+	IsDisabled       bool   `json:"isDisabled"`
+	IsFork           bool   `json:"isFork"`
+	IsTemplate       bool   `json:"isTemplate"`
+	IsEmpty          bool   `json:"isEmpty"`
+	DefaultBranchRef *struct {
+		Name string `json:"name"`
+	} `json:"defaultBranchRef"`
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+}
+
+type graphqlRepositoriesResponse struct {
+	Data struct {
+		Organization *struct {
+			Repositories struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Nodes []graphqlRepository `json:"nodes"`
+			} `json:"repositories"`
+		} `json:"organization"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphqlRepos lists all repos of the org with a single graphql query per page, which includes the repos' topics
+// and default branches
+func (gh *GH) graphqlRepos(org string) ([]*repository, error) {
+
+	var repos []*repository
+	var cursor *string
+
+	for {
+
+		if err := gh.ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "stopped listing github repos")
+		}
+
+		// the graphql endpoint is /graphql on github.com, and /api/graphql next to /api/v3 on enterprise servers
+		req, err := gh.client.NewRequest(http.MethodPost, "../graphql", graphqlRequest{
+			Query: graphqlRepositoriesQuery,
+			Variables: map[string]interface{}{
+				"org":    org,
+				"first":  gh.PerPage,
+				"cursor": cursor,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var result graphqlRepositoriesResponse
+		resp, err := gh.client.Do(gh.ctx, req, &result)
+		gh.budget.observe(resp, err)
+
+		switch err.(type) {
+		case *github.RateLimitError:
+			return nil, errors.Wrap(err, "github rate limit hit")
+		case *github.AbuseRateLimitError:
+			return nil, errors.Wrap(err, "github secondary rate limit hit")
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to query repos of %s: %v", org, status(resp))
+		}
+
+		// graphql answers 200 OK with errors, a partial result would make us remove config repos that still exist
+		if len(result.Errors) > 0 {
+			var messages []string
+			for _, e := range result.Errors {
+				messages = append(messages, e.Message)
+			}
+			return nil, fmt.Errorf("unable to query repos of %s: %s", org, strings.Join(messages, "; "))
+		}
+		if result.Data.Organization == nil {
+			return nil, fmt.Errorf("unable to query repos of %s: no such org", org)
+		}
+
+		for _, node := range result.Data.Organization.Repositories.Nodes {
+			repos = append(repos, node.toRepository())
+		}
+
+		pageInfo := result.Data.Organization.Repositories.PageInfo
+		if !pageInfo.HasNextPage {
+			break
+		}
+		cursor = github.String(pageInfo.EndCursor)
+	}
+
+	return repos, nil
+}
+
+// toRepository converts a graphql repo to the repository the rest of discovery works with
+func (r graphqlRepository) toRepository() *repository {
+
+	repo := &repository{
+		Repository: &github.Repository{
+			ID:       github.Int64(r.DatabaseID),
+			Name:     github.String(r.Name),
+			FullName: github.String(r.NameWithOwner),
+			CloneURL: github.String(r.URL + ".git"),
+			SSHURL:   github.String(r.SSHURL),
+			Archived: github.Bool(r.IsArchived),
+			Fork:     github.Bool(r.IsFork),
+		},
+		Disabled:   github.Bool(r.IsDisabled),
+		IsTemplate: github.Bool(r.IsTemplate),
+	}
+
+	if r.DefaultBranchRef != nil {
+		repo.DefaultBranch = github.String(r.DefaultBranchRef.Name)
+	}
+
+	// the empty policy goes by size, which is only 0 when nothing was ever pushed
+	if r.IsEmpty {
+		repo.Size = github.Int(0)
+	}
+
+	for _, node := range r.RepositoryTopics.Nodes {
+		repo.Topics = append(repo.Topics, node.Topic.Name)
+	}
+
+	return repo
+}
@@ -0,0 +1,124 @@
+package gh_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReposGraphQL(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/graphql", r.URL.Path)
+
+			var req struct {
+				Query     string                 `json:"query"`
+				Variables map[string]interface{} `json:"variables"`
+			}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "myorg", req.Variables["org"])
+			assert.Equal(t, float64(2), req.Variables["first"])
+
+			switch req.Variables["cursor"] {
+			case nil:
+				fmt.Fprintf(w, `{"data": {"organization": {"repositories": {
+					"pageInfo": {"hasNextPage": true, "endCursor": "Y3Vyc29yOjI="},
+					"nodes": [
+						{"databaseId": 1, "name": "one", "nameWithOwner": "myorg/one", "url": "https://github.com/myorg/one", "sshUrl": "git@github.com:myorg/one.git",
+						 "defaultBranchRef": {"name": "main"}, "repositoryTopics": {"nodes": [{"topic": {"name": "ci-gocd"}}]}},
+						{"databaseId": 2, "name": "two", "nameWithOwner": "myorg/two", "url": "https://github.com/myorg/two",
+						 "defaultBranchRef": {"name": "master"}, "repositoryTopics": {"nodes": []}}
+					]
+				}}}}`)
+			case "Y3Vyc29yOjI=":
+				fmt.Fprintf(w, `{"data": {"organization": {"repositories": {
+					"pageInfo": {"hasNextPage": false, "endCursor": "Y3Vyc29yOjM="},
+					"nodes": [
+						{"databaseId": 3, "name": "three", "nameWithOwner": "myorg/three", "url": "https://github.com/myorg/three", "isArchived": true,
+						 "defaultBranchRef": {"name": "master"}, "repositoryTopics": {"nodes": [{"topic": {"name": "ci-gocd"}}]}},
+						{"databaseId": 4, "name": "four", "nameWithOwner": "myorg/four", "url": "https://github.com/myorg/four", "isEmpty": true,
+						 "defaultBranchRef": null, "repositoryTopics": {"nodes": [{"topic": {"name": "ci-gocd"}}]}}
+					]
+				}}}}`)
+			default:
+				t.Fatalf("unexpected cursor %v", req.Variables["cursor"])
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubPerPage":    "2",
+			"GithubDiscovery":  gh.DiscoveryGraphQL,
+			"GithubRepoPolicy": "archived:remove,empty:skip",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, skipped, err := c.OrgRepos("myorg")
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 1) {
+		repo := gh.ToRepository(repos[0])
+		assert.Equal(t, "1", repo.ID)
+		assert.Equal(t, "myorg/one", repo.FullName)
+		assert.Equal(t, "https://github.com/myorg/one.git", repo.CloneURL)
+		assert.Equal(t, "git@github.com:myorg/one.git", repo.SSHURL)
+		assert.Equal(t, "main", repo.DefaultBranch)
+		assert.Equal(t, []string{"ci-gocd"}, repo.Topics)
+	}
+	if assert.Len(t, skipped, 1) {
+		assert.Equal(t, "four", skipped[0].GetName())
+	}
+}
+
+func TestReposGraphQLErrors(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"data": {"organization": null}, "errors": [{"message": "Could not resolve to an Organization with the login of 'myorg'."}]}`)
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubDiscovery":  gh.DiscoveryGraphQL,
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	_, _, err = c.OrgRepos("myorg")
+	assert.Regexp(t, "Could not resolve to an Organization", err)
+}
+
+func TestNewGraphQLWithoutOrg(t *testing.T) {
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":  "",
+			"GithubDiscovery": gh.DiscoveryGraphQL,
+		},
+		log.NewNopLogger(),
+		github.NewClient(nil),
+	)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
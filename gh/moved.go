@@ -0,0 +1,26 @@
+package gh
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// Moved returns true if the repo with the id belongs to another of the seeded orgs than org now, i.e. it was
+// transferred; a deleted repo, or one transferred elsewhere, has not moved
+func (gh *GH) Moved(id string, org string) (bool, error) {
+
+	var repo github.Repository
+	resp, err := gh.getCached(fmt.Sprintf("repositories/%s", id), &repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to get repo %s: %v", id, status(resp))
+	}
+
+	owner, ok := gh.ownedOrg(repo.GetOwner().GetLogin())
+	return ok && owner != org, nil
+}
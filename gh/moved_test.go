@@ -0,0 +1,63 @@
+package gh_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoved(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/repositories/1":
+				fmt.Fprintf(w, `{"id": 1, "full_name": "myorg/one", "owner": {"login": "myorg"}}`)
+			case "/repositories/2":
+				fmt.Fprintf(w, `{"id": 2, "full_name": "otherorg/two", "owner": {"login": "OtherOrg"}}`)
+			case "/repositories/3":
+				fmt.Fprintf(w, `{"id": 3, "full_name": "someone/three", "owner": {"login": "someone"}}`)
+			case "/repositories/5":
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch": "myorg,otherorg:oo",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	var movedTests = []struct {
+		name  string
+		id    string
+		moved bool
+		err   bool
+	}{
+		{name: "same_org", id: "1"},
+		{name: "transferred", id: "2", moved: true},
+		{name: "transferred_away", id: "3"},
+		{name: "deleted", id: "4"},
+		{name: "broken", id: "5", err: true},
+	}
+
+	for _, tt := range movedTests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved, err := c.(*gh.GH).Moved(tt.id, "myorg")
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.moved, moved)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package gh
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// NameMatcher decides by name which repos are seeded, using allow (include) and deny (exclude) lists of patterns;
+// patterns are globs, e.g. "tmp-*", or regular expressions when wrapped in slashes, e.g. "/^tmp-[0-9]+$/"
+type NameMatcher struct {
+	include []namePattern
+	exclude []namePattern
+}
+
+// namePattern is a single glob or regex, globs w/o a "/" match the repo's name, globs with a "/" match
+// the repo's full name (<org>/<repo>), regexes always match the full name
+type namePattern struct {
+	raw  string
+	glob string
+	re   *regexp.Regexp
+}
+
+// NewNameMatcher parses comma separated include and exclude patterns, no include patterns means all repos are included
+func NewNameMatcher(include string, exclude string) (*NameMatcher, error) {
+
+	var err error
+	m := &NameMatcher{}
+
+	m.include, err = parseNamePatterns(include)
+	if err != nil {
+		return nil, err
+	}
+
+	m.exclude, err = parseNamePatterns(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func parseNamePatterns(value string) ([]namePattern, error) {
+
+	var patterns []namePattern
+
+	for _, raw := range splitPatterns(value) {
+
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		if len(raw) > 2 && strings.HasPrefix(raw, "/") && strings.HasSuffix(raw, "/") {
+			re, err := regexp.Compile(raw[1 : len(raw)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex %s: %v", raw, err)
+			}
+			patterns = append(patterns, namePattern{raw: raw, re: re})
+			continue
+		}
+
+		// validate the glob once, path.Match only reports a bad pattern when it's used
+		if _, err := path.Match(raw, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %v", raw, err)
+		}
+		patterns = append(patterns, namePattern{raw: raw, glob: raw})
+	}
+
+	return patterns, nil
+}
+
+// splitPatterns splits a pattern list on the commas outside of {} and [], so repetitions such as {2,4} and
+// character classes such as [,;] stay part of their pattern
+func splitPatterns(value string) []string {
+
+	var parts []string
+	depth, start := 0, 0
+
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, value[start:])
+}
+
+func (p namePattern) match(fullName string) bool {
+
+	if p.re != nil {
+		return p.re.MatchString(fullName)
+	}
+
+	name := fullName
+	if !strings.Contains(p.glob, "/") {
+		name = fullName[strings.LastIndex(fullName, "/")+1:]
+	}
+
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+// Match returns true if the repo should be seeded, and the reason why it was included or excluded; exclude
+// patterns always win over include patterns
+func (m *NameMatcher) Match(fullName string) (bool, string) {
+
+	for _, p := range m.exclude {
+		if p.match(fullName) {
+			return false, "matched exclude pattern " + p.raw
+		}
+	}
+
+	if len(m.include) == 0 {
+		return true, "no include patterns set"
+	}
+
+	for _, p := range m.include {
+		if p.match(fullName) {
+			return true, "matched include pattern " + p.raw
+		}
+	}
+
+	return false, "did not match any include pattern"
+}
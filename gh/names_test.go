@@ -0,0 +1,52 @@
+package gh_test
+
+import (
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNameMatcherInvalid(t *testing.T) {
+	_, err := gh.NewNameMatcher("/[/", "")
+	assert.NotNil(t, err)
+
+	_, err = gh.NewNameMatcher("", "tmp-[")
+	assert.NotNil(t, err)
+}
+
+func TestNameMatcherMatch(t *testing.T) {
+	var nameMatcherTests = []struct {
+		name     string
+		include  string
+		exclude  string
+		fullName string
+		match    bool
+	}{
+		{name: "no_patterns", fullName: "gooflix/one", match: true},
+		{name: "exclude_suffix", exclude: "*-playground,tmp-*", fullName: "gooflix/my-playground", match: false},
+		{name: "exclude_prefix", exclude: "*-playground,tmp-*", fullName: "gooflix/tmp-one", match: false},
+		{name: "exclude_no_match", exclude: "*-playground,tmp-*", fullName: "gooflix/one", match: true},
+		{name: "exclude_full_name", exclude: "acme/*", fullName: "acme/one", match: false},
+		{name: "exclude_full_name_other_org", exclude: "acme/*", fullName: "gooflix/one", match: true},
+		{name: "include_match", include: "svc-*", fullName: "gooflix/svc-one", match: true},
+		{name: "include_no_match", include: "svc-*", fullName: "gooflix/one", match: false},
+		{name: "include_regex", include: `/^gooflix\/api-[0-9]+$/`, fullName: "gooflix/api-12", match: true},
+		{name: "include_regex_no_match", include: `/^gooflix\/api-[0-9]+$/`, fullName: "gooflix/api-x", match: false},
+		{name: "include_regex_repetition", include: `/^gooflix\/svc-[a-z]{2,4}$/,tmp-*`, fullName: "gooflix/svc-abc", match: true},
+		{name: "include_regex_repetition_no_match", include: `/^gooflix\/svc-[a-z]{2,4}$/,tmp-*`, fullName: "gooflix/svc-abcdef", match: false},
+		{name: "include_after_regex_repetition", include: `/^gooflix\/svc-[a-z]{2,4}$/,tmp-*`, fullName: "gooflix/tmp-one", match: true},
+		{name: "exclude_wins", include: "svc-*", exclude: "*-playground", fullName: "gooflix/svc-playground", match: false},
+	}
+
+	for _, tt := range nameMatcherTests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := gh.NewNameMatcher(tt.include, tt.exclude)
+			if assert.Nil(t, err) {
+				match, reason := m.Match(tt.fullName)
+				assert.Equal(t, tt.match, match)
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
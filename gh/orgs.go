@@ -0,0 +1,23 @@
+package gh
+
+import (
+	"strings"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+)
+
+// Org is a Github organization to discover repos in, Prefix namespaces the IDs of the GoCD config repos
+// created for the org's repos, so that each org only ever reconciles its own config repos
+type Org = source.Owner
+
+// ParseOrgs parses a comma separated list of orgs, e.g. "gooflix,acme:ac", each org can set its own config
+// repo ID prefix as <org>:<prefix>, the prefix defaults to the org's name
+func ParseOrgs(value string) ([]Org, error) {
+
+	// no org means the authenticated user's own repos
+	if strings.TrimSpace(value) == "" {
+		return []Org{{}}, nil
+	}
+
+	return source.ParseOwners(value)
+}
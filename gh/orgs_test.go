@@ -0,0 +1,79 @@
+package gh_test
+
+import (
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOrgs(t *testing.T) {
+	var parseOrgsTests = []struct {
+		name  string
+		value string
+		orgs  []gh.Org
+		err   bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			orgs:  []gh.Org{{}},
+		},
+		{
+			name:  "single",
+			value: "gooflix",
+			orgs:  []gh.Org{{Name: "gooflix", Prefix: "gooflix"}},
+		},
+		{
+			name:  "multiple_empty_prefix",
+			value: "gooflix, acme:ac,other:",
+			err:   true,
+		},
+		{
+			name:  "multiple",
+			value: "gooflix, acme:ac ,initech",
+			orgs: []gh.Org{
+				{Name: "gooflix", Prefix: "gooflix"},
+				{Name: "acme", Prefix: "ac"},
+				{Name: "initech", Prefix: "initech"},
+			},
+		},
+		{
+			name:  "single_empty_prefix",
+			value: "gooflix:",
+			orgs:  []gh.Org{{Name: "gooflix", Prefix: ""}},
+		},
+		{
+			name:  "duplicate_org",
+			value: "gooflix,gooflix:gf",
+			err:   true,
+		},
+		{
+			name:  "duplicate_prefix",
+			value: "gooflix:gf,acme:gf",
+			err:   true,
+		},
+		{
+			name:  "overlapping_prefix",
+			value: "gooflix:gf,acme:gf-acme",
+			err:   true,
+		},
+		{
+			name:  "missing_name",
+			value: ":gf",
+			err:   true,
+		},
+	}
+
+	for _, tt := range parseOrgsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			orgs, err := gh.ParseOrgs(tt.value)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.orgs, orgs)
+		})
+	}
+}
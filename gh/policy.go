@@ -0,0 +1,117 @@
+package gh
+
+import (
+	"fmt"
+	"strings"
+)
+
+// policies decide what happens to repos that carry the topic but are archived, disabled, forks, templates or empty
+const (
+	// PolicySeed seeds the repo like any other repo
+	PolicySeed = "seed"
+	// PolicySkip does not seed the repo, an existing config repo is left alone
+	PolicySkip = "skip"
+	// PolicyRemove treats the repo as removed, so an existing config repo is reconciled away
+	PolicyRemove = "remove"
+)
+
+// the kinds of repos a policy can be set for
+const (
+	KindArchived = "archived"
+	KindDisabled = "disabled"
+	KindFork     = "fork"
+	KindTemplate = "template"
+	KindEmpty    = "empty"
+)
+
+var repoKinds = []string{KindArchived, KindDisabled, KindFork, KindTemplate, KindEmpty}
+
+// Policies maps a kind of repo to its policy, kinds w/o a policy are seeded
+type Policies map[string]string
+
+// ParsePolicies parses a comma separated list of <kind>:<policy>, e.g. "archived:remove,fork:skip"
+func ParsePolicies(value string) (Policies, error) {
+
+	policies := Policies{}
+
+	for _, entry := range strings.Split(value, ",") {
+
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid repo policy %q, must be <kind>:<policy>", entry)
+		}
+		kind, policy := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		if !validKind(kind) {
+			return nil, fmt.Errorf("invalid repo kind %q, must be one of: %s", kind, strings.Join(repoKinds, ", "))
+		}
+
+		switch policy {
+		case PolicySeed, PolicySkip, PolicyRemove:
+		default:
+			return nil, fmt.Errorf("invalid repo policy %q for %s, must be one of: %s, %s, %s", policy, kind, PolicySeed, PolicySkip, PolicyRemove)
+		}
+
+		policies[kind] = policy
+	}
+
+	return policies, nil
+}
+
+func validKind(kind string) bool {
+	for _, k := range repoKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// kinds returns the kinds of the repo that policies can be set for
+func (r *repository) kinds() []string {
+	var kinds []string
+
+	if r.GetArchived() {
+		kinds = append(kinds, KindArchived)
+	}
+	if r.Disabled != nil && *r.Disabled {
+		kinds = append(kinds, KindDisabled)
+	}
+	if r.GetFork() {
+		kinds = append(kinds, KindFork)
+	}
+	if r.IsTemplate != nil && *r.IsTemplate {
+		kinds = append(kinds, KindTemplate)
+	}
+	// size is in KB and only 0 when nothing was ever pushed
+	if r.Size != nil && *r.Size == 0 {
+		kinds = append(kinds, KindEmpty)
+	}
+
+	return kinds
+}
+
+// apply returns the policy for the repo, and the kind of repo that caused it; remove is stronger than skip, which is
+// stronger than seed, so e.g. an archived fork is removed if either archived or fork repos are to be removed
+func (p Policies) apply(r *repository) (string, string) {
+
+	policy, cause := PolicySeed, ""
+
+	for _, kind := range r.kinds() {
+		switch p[kind] {
+		case PolicyRemove:
+			return PolicyRemove, kind
+		case PolicySkip:
+			if policy == PolicySeed {
+				policy, cause = PolicySkip, kind
+			}
+		}
+	}
+
+	return policy, cause
+}
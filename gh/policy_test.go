@@ -0,0 +1,67 @@
+package gh_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := gh.ParsePolicies("archived:remove, fork:skip,empty:seed")
+	assert.Nil(t, err)
+	assert.Equal(t, gh.Policies{"archived": "remove", "fork": "skip", "empty": "seed"}, policies)
+
+	for _, value := range []string{"archived", "archived:delete", "private:skip"} {
+		_, err := gh.ParsePolicies(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestOrgReposPolicies(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `[
+				{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"], "size": 10},
+				{"name": "archived", "full_name": "myorg/archived", "topics": ["ci-gocd"], "archived": true, "size": 10},
+				{"name": "disabled", "full_name": "myorg/disabled", "topics": ["ci-gocd"], "disabled": true, "size": 10},
+				{"name": "fork", "full_name": "myorg/fork", "topics": ["ci-gocd"], "fork": true, "size": 10},
+				{"name": "template", "full_name": "myorg/template", "topics": ["ci-gocd"], "is_template": true, "size": 10},
+				{"name": "empty", "full_name": "myorg/empty", "topics": ["ci-gocd"], "size": 0},
+				{"name": "archived-fork", "full_name": "myorg/archived-fork", "topics": ["ci-gocd"], "archived": true, "fork": true, "size": 10}
+			]`)
+		}))
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubRepoPolicy": "archived:remove,disabled:remove,fork:skip,template:skip,empty:seed",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, skipped, err := c.OrgRepos("myorg")
+	assert.Nil(t, err)
+
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.GetName())
+	}
+	assert.Equal(t, []string{"one", "empty"}, names)
+
+	names = nil
+	for _, repo := range skipped {
+		names = append(names, repo.GetName())
+	}
+	assert.Equal(t, []string{"fork", "template"}, names)
+}
@@ -0,0 +1,103 @@
+package gh
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// DefaultRateLimitReserve is the number of requests kept in reserve, discovery waits for the rate limit to reset
+// once fewer requests are left
+const DefaultRateLimitReserve = 100
+
+// rateBudget tracks the github rate limit from the X-RateLimit-* headers of each response, and the Retry-After
+// of secondary (abuse) rate limits
+type rateBudget struct {
+	mu         sync.Mutex
+	reserve    int
+	remaining  int
+	reset      time.Time
+	retryAfter time.Time
+	now        func() time.Time
+}
+
+func newRateBudget(reserve int) *rateBudget {
+	return &rateBudget{reserve: reserve, remaining: -1, now: time.Now}
+}
+
+// observe updates the budget from a response, err is the error go-github returned for it
+func (b *rateBudget) observe(resp *github.Response, err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch e := errors.Cause(err).(type) {
+	case *github.RateLimitError:
+		b.remaining = 0
+		b.reset = e.Rate.Reset.Time
+		return
+	case *github.AbuseRateLimitError:
+		if e.RetryAfter != nil {
+			b.retryAfter = b.now().Add(*e.RetryAfter)
+			return
+		}
+	}
+
+	if resp == nil || resp.Response == nil {
+		return
+	}
+
+	// newer secondary rate limits are a 403 or 429 that go-github doesn't recognize, they carry a Retry-After too
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			b.retryAfter = b.now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	// only the core rate limit is tracked, the search and graphql apis (and others) have limits of their own which must
+	// not be mistaken for it; older github enterprise versions don't name the resource at all
+	if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" && resource != "core" {
+		return
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") != "" {
+		b.remaining = resp.Rate.Remaining
+		b.reset = resp.Rate.Reset.Time
+	}
+}
+
+// delay returns how long to wait before github should be called again, 0 if it can be called right away
+func (b *rateBudget) delay() time.Duration {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	if b.retryAfter.After(now) {
+		return b.retryAfter.Sub(now)
+	}
+
+	if b.remaining >= 0 && b.remaining <= b.reserve && b.reset.After(now) {
+		return b.reset.Sub(now)
+	}
+
+	return 0
+}
+
+// Delay implements source.Throttled, it returns how long discovery should wait for the github rate limit
+func (gh *GH) Delay() time.Duration {
+	return gh.budget.delay()
+}
+
+// RateLimitRemaining returns the number of requests left until the github rate limit resets, -1 before the first
+// request
+func (gh *GH) RateLimitRemaining() int {
+	gh.budget.mu.Lock()
+	defer gh.budget.mu.Unlock()
+	return gh.budget.remaining
+}
@@ -0,0 +1,159 @@
+package gh_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitDelay(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(2*time.Minute).Unix(), 10)
+
+	var rateLimitTests = []struct {
+		name      string
+		discovery string
+		handler   func(w http.ResponseWriter)
+		err       string
+		remaining int
+		delay     time.Duration
+	}{
+		{
+			name: "plenty_left",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Remaining", "4000")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				fmt.Fprintf(w, `[]`)
+			},
+			remaining: 4000,
+		},
+		{
+			name: "below_reserve",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Remaining", "50")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				fmt.Fprintf(w, `[]`)
+			},
+			remaining: 50,
+			delay:     2 * time.Minute,
+		},
+		{
+			name: "exceeded",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"message": "API rate limit exceeded for user ID 1."}`)
+			},
+			err:   "^github rate limit hit",
+			delay: 2 * time.Minute,
+		},
+		{
+			name: "abuse",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"message": "You have triggered an abuse detection mechanism.", "documentation_url": "https://developer.github.com/v3/#abuse-rate-limits"}`)
+			},
+			err:       "^github secondary rate limit hit",
+			remaining: -1,
+			delay:     30 * time.Second,
+		},
+		{
+			name: "too_many_requests",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			err:       "429",
+			remaining: -1,
+			delay:     time.Minute,
+		},
+		{
+			name:      "search_limit_is_separate",
+			discovery: "search",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Resource", "search")
+				w.Header().Set("X-RateLimit-Remaining", "5")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				fmt.Fprintf(w, `{"total_count": 0, "incomplete_results": false, "items": []}`)
+			},
+			remaining: -1,
+		},
+		{
+			name: "graphql_limit_is_separate",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Resource", "graphql")
+				w.Header().Set("X-RateLimit-Remaining", "5")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				fmt.Fprintf(w, `[]`)
+			},
+			remaining: -1,
+		},
+		{
+			name: "core_limit",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Resource", "core")
+				w.Header().Set("X-RateLimit-Remaining", "50")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				fmt.Fprintf(w, `[]`)
+			},
+			remaining: 50,
+			delay:     2 * time.Minute,
+		},
+	}
+
+	for _, tt := range rateLimitTests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					tt.handler(w)
+				}))
+			defer hs.Close()
+
+			c, err := gh.New(
+				context.Background(),
+				map[string]string{
+					"GithubOrgMatch":   "myorg",
+					"GithubTopicMatch": "ci-gocd",
+					"GithubDiscovery":  tt.discovery,
+				},
+				log.NewNopLogger(),
+				newTestClient(hs),
+			)
+			assert.Nil(t, err)
+
+			_, _, err = c.OrgRepos("myorg")
+			if tt.err != "" {
+				assert.Regexp(t, tt.err, err)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			assert.Equal(t, tt.remaining, c.(*gh.GH).RateLimitRemaining())
+			assert.InDelta(t, tt.delay.Seconds(), c.(*gh.GH).Delay().Seconds(), 5)
+		})
+	}
+}
+
+func TestNewInvalidRateLimitReserve(t *testing.T) {
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubAPIKey":           "aabbcc",
+			"GithubRateLimitReserve": "-1",
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
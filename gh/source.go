@@ -0,0 +1,99 @@
+package gh
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/google/go-github/github"
+)
+
+// OrgSource is a source.Source for the repos of a single Github org
+type OrgSource struct {
+	gh  *GH
+	org string
+}
+
+// NewOrgSource returns a source.Source for the org's repos
+func NewOrgSource(gh *GH, org string) *OrgSource {
+	return &OrgSource{gh: gh, org: org}
+}
+
+// Repos implements source.Source
+func (s *OrgSource) Repos() ([]*source.Repository, []*source.Repository, error) {
+	repos, skipped, err := s.gh.OrgRepos(s.org)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.withTeams(ToRepositories(repos)), s.withTeams(ToRepositories(skipped)), nil
+}
+
+// withTeams records the team that owns each repo
+func (s *OrgSource) withTeams(repos []*source.Repository) []*source.Repository {
+	for _, repo := range repos {
+		repo.Team = s.gh.Team(repo.FullName)
+	}
+	return repos
+}
+
+// HasConfigFile implements source.Source
+func (s *OrgSource) HasConfigFile(repo *source.Repository) (bool, error) {
+	return s.gh.HasConfigFile(repo)
+}
+
+// FetchFile implements source.FileFetcher
+func (s *OrgSource) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+	return s.gh.FetchFile(repo, file)
+}
+
+// Branches implements source.BranchLister
+func (s *OrgSource) Branches(repo *source.Repository) ([]string, error) {
+	return s.gh.Branches(repo)
+}
+
+// PullRequests implements source.PullRequestLister
+func (s *OrgSource) PullRequests(repo *source.Repository) ([]source.PullRequest, error) {
+	return s.gh.PullRequests(repo)
+}
+
+// Credentials implements source.Credentialer, all of the org's repos are cloned with the same credentials
+func (s *OrgSource) Credentials(repo *source.Repository) (string, string, error) {
+	return s.gh.Credentials()
+}
+
+// Moved implements source.Mover
+func (s *OrgSource) Moved(id string) (bool, error) {
+	return s.gh.Moved(id, s.org)
+}
+
+// Delay implements source.Throttled
+func (s *OrgSource) Delay() time.Duration {
+	return s.gh.Delay()
+}
+
+// ToRepository converts a Github repository into the repository model used by the rest of the seeder
+func ToRepository(repo *github.Repository) *source.Repository {
+	id := ""
+	if repo.ID != nil {
+		id = strconv.FormatInt(repo.GetID(), 10)
+	}
+
+	return &source.Repository{
+		ID:            id,
+		Name:          repo.GetName(),
+		FullName:      repo.GetFullName(),
+		CloneURL:      repo.GetCloneURL(),
+		SSHURL:        repo.GetSSHURL(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Topics:        repo.Topics,
+	}
+}
+
+// ToRepositories converts Github repositories, see ToRepository
+func ToRepositories(repos []*github.Repository) []*source.Repository {
+	converted := make([]*source.Repository, 0, len(repos))
+	for _, repo := range repos {
+		converted = append(converted, ToRepository(repo))
+	}
+	return converted
+}
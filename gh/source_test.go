@@ -0,0 +1,32 @@
+package gh_test
+
+import (
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToRepository(t *testing.T) {
+	repo := gh.ToRepository(&github.Repository{
+		ID:            github.Int64(1234567890),
+		Name:          github.String("one"),
+		FullName:      github.String("gooflix/one"),
+		CloneURL:      github.String("https://github.com/gooflix/one.git"),
+		SSHURL:        github.String("git@github.com:gooflix/one.git"),
+		DefaultBranch: github.String("main"),
+		Topics:        []string{"ci-gocd"},
+	})
+
+	assert.Equal(t, &source.Repository{
+		ID:            "1234567890",
+		Name:          "one",
+		FullName:      "gooflix/one",
+		CloneURL:      "https://github.com/gooflix/one.git",
+		SSHURL:        "git@github.com:gooflix/one.git",
+		DefaultBranch: "main",
+		Topics:        []string{"ci-gocd"},
+	}, repo)
+}
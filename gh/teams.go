@@ -0,0 +1,107 @@
+package gh
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// ParseTeams parses a comma separated list of team slugs, e.g. "platform,infra"; the order matters, a repo that
+// several of the teams have access to is owned by the first of them
+func ParseTeams(value string) []string {
+
+	var teams []string
+	seen := map[string]bool{}
+
+	for _, team := range strings.Split(value, ",") {
+		team = strings.ToLower(strings.TrimSpace(team))
+		if team == "" || seen[team] {
+			continue
+		}
+		seen[team] = true
+		teams = append(teams, team)
+	}
+
+	return teams
+}
+
+// teamRepos returns the full names (lower case) of the repos the org's teams have access to, mapped to the team
+// that owns them
+func (gh *GH) teamRepos(org string) (map[string]string, error) {
+
+	owners := map[string]string{}
+
+	for _, team := range gh.Teams {
+
+		page := 1
+
+		for {
+
+			if err := gh.ctx.Err(); err != nil {
+				return nil, errors.Wrap(err, "stopped listing github team repos")
+			}
+
+			var found []*repository
+
+			resp, err := gh.getCached(fmt.Sprintf("orgs/%s/teams/%s/repos?per_page=%d&page=%d", org, team, gh.PerPage, page), &found)
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return nil, fmt.Errorf("github team %s not found in %s", team, org)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to get repos of team %s/%s: %v", org, team, status(resp))
+			}
+
+			for _, repo := range found {
+				if _, ok := owners[strings.ToLower(repo.GetFullName())]; !ok {
+					owners[strings.ToLower(repo.GetFullName())] = team
+				}
+			}
+
+			if resp.NextPage == 0 {
+				break
+			}
+			page = resp.NextPage
+		}
+	}
+
+	return owners, nil
+}
+
+// repoTeam returns the team that owns a single repo, or an empty string if none of the teams has access to it
+func (gh *GH) repoTeam(repo *github.Repository) (string, error) {
+
+	var teams []*github.Team
+
+	owner, name := splitFullName(repo.GetFullName())
+	resp, err := gh.get(fmt.Sprintf("repos/%s/%s/teams?per_page=100", owner, name), &teams)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get teams of %s: %v", repo.GetFullName(), status(resp))
+	}
+
+	for _, team := range gh.Teams {
+		for _, t := range teams {
+			if strings.EqualFold(t.GetSlug(), team) {
+				return team, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// Team returns the team that owns the repo, as of its last discovery; it is empty when no teams were set
+func (gh *GH) Team(fullName string) string {
+	gh.ownersMu.Lock()
+	defer gh.ownersMu.Unlock()
+	return gh.owners[strings.ToLower(fullName)]
+}
+
+// setTeam records the team that owns the repo
+func (gh *GH) setTeam(fullName string, team string) {
+	gh.ownersMu.Lock()
+	defer gh.ownersMu.Unlock()
+	gh.owners[strings.ToLower(fullName)] = team
+}
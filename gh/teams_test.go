@@ -0,0 +1,135 @@
+package gh_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTeams(t *testing.T) {
+	assert.Equal(t, []string{"platform", "infra"}, gh.ParseTeams(" Platform, infra,,platform"))
+	assert.Nil(t, gh.ParseTeams(""))
+}
+
+func newTeamsServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/orgs/myorg/repos":
+				fmt.Fprintf(w, `[
+					{"name": "one", "full_name": "myorg/one", "topics": ["ci-gocd"]},
+					{"name": "two", "full_name": "myorg/two", "topics": ["ci-gocd"]},
+					{"name": "three", "full_name": "myorg/three", "topics": ["ci-gocd"]},
+					{"name": "four", "full_name": "myorg/four"}
+				]`)
+			case "/orgs/myorg/teams/platform/repos":
+				fmt.Fprintf(w, `[{"name": "one", "full_name": "myorg/one"}, {"name": "four", "full_name": "myorg/four"}]`)
+			case "/orgs/myorg/teams/infra/repos":
+				fmt.Fprintf(w, `[{"name": "One", "full_name": "myorg/One"}, {"name": "two", "full_name": "myorg/two"}]`)
+			case "/repos/myorg/five/teams":
+				fmt.Fprintf(w, `[{"slug": "frontend"}, {"slug": "infra"}]`)
+			case "/repos/myorg/six/teams":
+				fmt.Fprintf(w, `[{"slug": "frontend"}]`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+}
+
+func TestReposTeams(t *testing.T) {
+	hs := newTeamsServer(t)
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubTeams":      "platform,infra",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	repos, _, err := gh.NewOrgSource(c.(*gh.GH), "myorg").Repos()
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 2) {
+		assert.Equal(t, "myorg/one", repos[0].FullName)
+		assert.Equal(t, "platform", repos[0].Team)
+		assert.Equal(t, "myorg/two", repos[1].FullName)
+		assert.Equal(t, "infra", repos[1].Team)
+	}
+}
+
+func TestReposUnknownTeam(t *testing.T) {
+	hs := newTeamsServer(t)
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubTeams":      "platfrom",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	_, _, err = c.OrgRepos("myorg")
+	assert.Regexp(t, "github team platfrom not found in myorg", err)
+}
+
+func TestRepoEventTeams(t *testing.T) {
+	hs := newTeamsServer(t)
+	defer hs.Close()
+
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubTeams":      "platform,infra",
+		},
+		log.NewNopLogger(),
+		newTestClient(hs),
+	)
+	assert.Nil(t, err)
+
+	changes, err := c.(*gh.GH).RepoEvent([]byte(`{"action": "created", "repository": {"name": "five", "full_name": "myorg/five", "owner": {"login": "myorg"}, "topics": ["ci-gocd"]}}`))
+	assert.Nil(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, gh.PolicySeed, changes[0].Action)
+		assert.Equal(t, "infra", changes[0].Team)
+	}
+
+	changes, err = c.(*gh.GH).RepoEvent([]byte(`{"action": "created", "repository": {"name": "six", "full_name": "myorg/six", "owner": {"login": "myorg"}, "topics": ["ci-gocd"]}}`))
+	assert.Nil(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, gh.PolicyRemove, changes[0].Action)
+	}
+}
+
+func TestNewTeamsWithoutOrg(t *testing.T) {
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubAPIKey":   "aabbcc",
+			"GithubOrgMatch": "",
+			"GithubTeams":    "platform",
+		},
+		log.NewNopLogger(),
+		nil,
+	)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
@@ -0,0 +1,198 @@
+package gh
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TopicExpr is a parsed boolean topic expression, e.g. "ci-gocd AND NOT deprecated"
+type TopicExpr interface {
+	Match(topics []string) bool
+}
+
+type topicLiteral string
+
+type topicNot struct {
+	expr TopicExpr
+}
+
+type topicAnd []TopicExpr
+
+type topicOr []TopicExpr
+
+// Match returns true when the topic is one of the topics
+func (t topicLiteral) Match(topics []string) bool {
+	for _, topic := range topics {
+		if topic == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true when the negated expression does not match
+func (t topicNot) Match(topics []string) bool {
+	return !t.expr.Match(topics)
+}
+
+// Match returns true when all expressions match
+func (t topicAnd) Match(topics []string) bool {
+	for _, expr := range t {
+		if !expr.Match(topics) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns true when any of the expressions match
+func (t topicOr) Match(topics []string) bool {
+	for _, expr := range t {
+		if expr.Match(topics) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTopicExpr parses a boolean topic expression, topics can be combined using AND, OR, NOT and
+// parentheses, NOT binds tighter than AND, which binds tighter than OR; a single topic is a valid expression
+func ParseTopicExpr(expr string) (TopicExpr, error) {
+
+	p := &topicParser{tokens: tokenizeTopicExpr(expr)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty topic expression")
+	}
+
+	t, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in topic expression %q", p.tokens[p.pos], expr)
+	}
+
+	return t, nil
+}
+
+// tokenizeTopicExpr splits an expression into topics, operators and parentheses
+func tokenizeTopicExpr(expr string) []string {
+	expr = strings.Replace(expr, "(", " ( ", -1)
+	expr = strings.Replace(expr, ")", " ) ", -1)
+	return strings.Fields(expr)
+}
+
+// topicParser is a recursive descent parser for topic expressions
+type topicParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *topicParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *topicParser) isOperator(op string) bool {
+	return strings.EqualFold(p.peek(), op)
+}
+
+func (p *topicParser) parseOr() (TopicExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := topicOr{left}
+	for p.isOperator("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, right)
+	}
+	if len(or) == 1 {
+		return left, nil
+	}
+	return or, nil
+}
+
+func (p *topicParser) parseAnd() (TopicExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	and := topicAnd{left}
+	for p.isOperator("AND") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, right)
+	}
+	if len(and) == 1 {
+		return left, nil
+	}
+	return and, nil
+}
+
+func (p *topicParser) parseNot() (TopicExpr, error) {
+	token := p.peek()
+
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of topic expression")
+	case strings.EqualFold(token, "NOT"):
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return topicNot{expr: expr}, nil
+	case token == "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in topic expression")
+		}
+		p.pos++
+		return expr, nil
+	case token == ")", strings.EqualFold(token, "AND"), strings.EqualFold(token, "OR"):
+		return nil, fmt.Errorf("unexpected %q in topic expression", token)
+	}
+
+	p.pos++
+	return topicLiteral(token), nil
+}
+
+// positiveTopics returns the topics a repo may need to carry to match the expression, i.e. all topics that are
+// not negated; a repo that matches the expression always carries at least one of them, unless the expression
+// also matches repos without any topics at all
+func positiveTopics(expr TopicExpr, negated bool) []string {
+	var topics []string
+
+	switch t := expr.(type) {
+	case topicLiteral:
+		if !negated {
+			topics = append(topics, string(t))
+		}
+	case topicNot:
+		topics = append(topics, positiveTopics(t.expr, !negated)...)
+	case topicAnd:
+		for _, e := range t {
+			topics = append(topics, positiveTopics(e, negated)...)
+		}
+	case topicOr:
+		for _, e := range t {
+			topics = append(topics, positiveTopics(e, negated)...)
+		}
+	}
+
+	return topics
+}
@@ -0,0 +1,49 @@
+package gh_test
+
+import (
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTopicExprInvalid(t *testing.T) {
+	for _, expr := range []string{"", "AND", "ci-gocd AND", "ci-gocd OR OR other", "(ci-gocd", "ci-gocd)", "NOT", "ci-gocd other"} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := gh.ParseTopicExpr(expr)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestTopicExprMatch(t *testing.T) {
+	var topicExprTests = []struct {
+		expr   string
+		topics []string
+		match  bool
+	}{
+		{expr: "ci-gocd", topics: []string{"go", "ci-gocd"}, match: true},
+		{expr: "ci-gocd", topics: []string{"go"}, match: false},
+		{expr: "ci-gocd", topics: nil, match: false},
+		{expr: "ci-gocd AND NOT deprecated", topics: []string{"ci-gocd"}, match: true},
+		{expr: "ci-gocd AND NOT deprecated", topics: []string{"ci-gocd", "deprecated"}, match: false},
+		{expr: "ci-gocd and not deprecated", topics: []string{"ci-gocd", "deprecated"}, match: false},
+		{expr: "ci-gocd OR gocd-pipelines", topics: []string{"gocd-pipelines"}, match: true},
+		{expr: "ci-gocd OR gocd-pipelines", topics: []string{"jenkins"}, match: false},
+		{expr: "a OR b AND c", topics: []string{"a"}, match: true},
+		{expr: "a OR b AND c", topics: []string{"b"}, match: false},
+		{expr: "(a OR b) AND c", topics: []string{"a"}, match: false},
+		{expr: "(a OR b) AND c", topics: []string{"b", "c"}, match: true},
+		{expr: "NOT NOT a", topics: []string{"a"}, match: true},
+		{expr: "NOT (a OR b)", topics: nil, match: true},
+	}
+
+	for _, tt := range topicExprTests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := gh.ParseTopicExpr(tt.expr)
+			if assert.Nil(t, err) {
+				assert.Equal(t, tt.match, expr.Match(tt.topics))
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package gh
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// maxWebhookPayload is the largest payload github sends, see https://docs.github.com/en/webhooks
+const maxWebhookPayload = 25 << 20
+
+// Change is what a webhook event means for the config repo of a repo in one of the orgs, Action is one of
+// PolicySeed, PolicySkip or PolicyRemove; Team is the team that owns the repo, if teams were set; Moved is set on the
+// removal of a repo's old name or owner after it was renamed or transferred, its config repo may move along with it
+type Change struct {
+	Org    string
+	Repo   *github.Repository
+	Action string
+	Team   string
+	Moved  bool
+}
+
+// repositoryEvent is the payload of a github repository webhook event
+type repositoryEvent struct {
+	Action     string      `json:"action"`
+	Repository *repository `json:"repository"`
+	Changes    struct {
+		Repository struct {
+			Name struct {
+				From string `json:"from"`
+			} `json:"name"`
+		} `json:"repository"`
+		Owner struct {
+			From struct {
+				Organization *github.Organization `json:"organization"`
+				User         *github.User         `json:"user"`
+			} `json:"from"`
+		} `json:"owner"`
+	} `json:"changes"`
+}
+
+// RepoEvent returns the changes a repository webhook event means for the orgs' config repos; the repo is evaluated
+// like during discovery (topics, names and policies), events of other orgs are ignored
+func (gh *GH) RepoEvent(payload []byte) ([]Change, error) {
+
+	var event repositoryEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling repository event")
+	}
+	if event.Repository == nil || event.Repository.Repository == nil {
+		return nil, errors.New("repository event without a repository")
+	}
+
+	var changes []Change
+	rr := event.Repository
+	org, ours := gh.ownedOrg(rr.GetOwner().GetLogin())
+
+	switch event.Action {
+	case "deleted":
+		if ours {
+			changes = append(changes, Change{Org: org, Repo: rr.Repository, Action: PolicyRemove})
+		}
+		return changes, nil
+
+	case "renamed":
+		// config repos are named after the repo, so the old one goes and a new one is seeded, unless it is tracked
+		if from := event.Changes.Repository.Name.From; ours && from != "" {
+			changes = append(changes, Change{Org: org, Repo: renamed(rr.Repository, rr.GetOwner().GetLogin(), from), Action: PolicyRemove, Moved: true})
+		}
+
+	case "transferred":
+		from := event.Changes.Owner.From.Organization.GetLogin()
+		if from == "" {
+			from = event.Changes.Owner.From.User.GetLogin()
+		}
+		if fromOrg, ok := gh.ownedOrg(from); ok && from != "" {
+			changes = append(changes, Change{Org: fromOrg, Repo: renamed(rr.Repository, from, rr.GetName()), Action: PolicyRemove, Moved: true})
+		}
+	}
+
+	// created, edited (e.g. topics), archived, unarchived, ... and the new side of renames and transfers
+	if !ours {
+		return changes, nil
+	}
+
+	// the teams' repos are listed per team during discovery, here we only need to know about the one repo
+	team := ""
+	if len(gh.Teams) > 0 {
+		var err error
+		team, err = gh.repoTeam(rr.Repository)
+		if err != nil {
+			return nil, err
+		}
+		if team == "" {
+			return append(changes, Change{Org: org, Repo: rr.Repository, Action: PolicyRemove}), nil
+		}
+		gh.setTeam(rr.GetFullName(), team)
+	}
+
+	changes = append(changes, Change{Org: org, Repo: rr.Repository, Action: gh.evaluate(rr), Team: team})
+
+	return changes, nil
+}
+
+// ownedOrg returns the configured org the owner is, w/o an org all of the user's repos are seeded
+func (gh *GH) ownedOrg(owner string) (string, bool) {
+	for _, org := range gh.Orgs {
+		if org.Name == "" || strings.EqualFold(org.Name, owner) {
+			return org.Name, true
+		}
+	}
+	return "", false
+}
+
+// renamed returns a copy of the repo with another owner and name, i.e. the repo before it was renamed or transferred
+func renamed(repo *github.Repository, owner string, name string) *github.Repository {
+	r := *repo
+	r.Name = github.String(name)
+	r.FullName = github.String(owner + "/" + name)
+	return &r
+}
+
+// WebhookHandler receives github webhooks, verifies their signature, and passes the changes repository events mean
+// to apply
+type WebhookHandler struct {
+	gh     *GH
+	secret []byte
+	apply  func([]Change)
+	logger log.Logger
+}
+
+// NewWebhookHandler returns a handler for github webhooks signed with the secret, apply is called in its own
+// goroutine so github isn't kept waiting
+func NewWebhookHandler(gh *GH, secret string, apply func([]Change), logger log.Logger) (*WebhookHandler, error) {
+
+	// anybody could create or remove config repos otherwise
+	if secret == "" {
+		return nil, errors.New("missing github webhook secret")
+	}
+
+	return &WebhookHandler{
+		gh:     gh,
+		secret: []byte(secret),
+		apply:  apply,
+		logger: logger,
+	}, nil
+}
+
+// ServeHTTP implements http.Handler
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "unable to read payload", http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(payload, r.Header.Get("X-Hub-Signature-256"), h.secret) {
+		level.Warn(h.logger).Log("msg", "github webhook with an invalid signature", "delivery", r.Header.Get("X-GitHub-Delivery"))
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		w.WriteHeader(http.StatusOK)
+
+	case "repository":
+		changes, err := h.gh.RepoEvent(payload)
+		if err != nil {
+			level.Warn(h.logger).Log("msg", errors.Wrap(err, "invalid github webhook"), "delivery", r.Header.Get("X-GitHub-Delivery"))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level.Debug(h.logger).Log("msg", "github repository webhook", "delivery", r.Header.Get("X-GitHub-Delivery"), "changes", len(changes))
+		go h.apply(changes)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		// only repository events are of interest, polling still catches everything else
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validSignature returns true if the X-Hub-Signature-256 header is the payload's HMAC with the secret
+func validSignature(payload []byte, signature string, secret []byte) bool {
+
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,169 @@
+package gh_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/go-kit/kit/log"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWebhookGH(t *testing.T) *gh.GH {
+	c, err := gh.New(
+		context.Background(),
+		map[string]string{
+			"GithubOrgMatch":   "myorg,otherorg:oo",
+			"GithubTopicMatch": "ci-gocd",
+			"GithubRepoPolicy": "archived:remove,fork:skip",
+		},
+		log.NewNopLogger(),
+		github.NewClient(nil),
+	)
+	assert.Nil(t, err)
+	return c.(*gh.GH)
+}
+
+func sign(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestRepoEvent(t *testing.T) {
+	var repoEventTests = []struct {
+		name    string
+		payload string
+		changes []string
+	}{
+		{
+			name:    "created",
+			payload: `{"action": "created", "repository": {"name": "one", "full_name": "myorg/one", "owner": {"login": "myorg"}, "topics": ["ci-gocd"]}}`,
+			changes: []string{"myorg seed myorg/one"},
+		},
+		{
+			name:    "created_without_topic",
+			payload: `{"action": "created", "repository": {"name": "one", "full_name": "myorg/one", "owner": {"login": "myorg"}}}`,
+			changes: []string{"myorg remove myorg/one"},
+		},
+		{
+			name:    "deleted",
+			payload: `{"action": "deleted", "repository": {"name": "one", "full_name": "myorg/one", "owner": {"login": "myorg"}, "topics": ["ci-gocd"]}}`,
+			changes: []string{"myorg remove myorg/one"},
+		},
+		{
+			name:    "archived",
+			payload: `{"action": "archived", "repository": {"name": "one", "full_name": "myorg/one", "owner": {"login": "myorg"}, "archived": true, "topics": ["ci-gocd"]}}`,
+			changes: []string{"myorg remove myorg/one"},
+		},
+		{
+			name:    "fork",
+			payload: `{"action": "created", "repository": {"name": "one", "full_name": "myorg/one", "owner": {"login": "myorg"}, "fork": true, "topics": ["ci-gocd"]}}`,
+			changes: []string{"myorg skip myorg/one"},
+		},
+		{
+			name:    "topic_removed",
+			payload: `{"action": "edited", "changes": {"topics": {"from": ["ci-gocd"]}}, "repository": {"name": "one", "full_name": "myorg/one", "owner": {"login": "myorg"}, "topics": []}}`,
+			changes: []string{"myorg remove myorg/one"},
+		},
+		{
+			name:    "renamed",
+			payload: `{"action": "renamed", "changes": {"repository": {"name": {"from": "one"}}}, "repository": {"name": "uno", "full_name": "myorg/uno", "owner": {"login": "myorg"}, "topics": ["ci-gocd"]}}`,
+			changes: []string{"myorg remove myorg/one (moved)", "myorg seed myorg/uno"},
+		},
+		{
+			name:    "transferred_between_orgs",
+			payload: `{"action": "transferred", "changes": {"owner": {"from": {"organization": {"login": "myorg"}}}}, "repository": {"name": "one", "full_name": "otherorg/one", "owner": {"login": "otherorg"}, "topics": ["ci-gocd"]}}`,
+			changes: []string{"myorg remove myorg/one (moved)", "otherorg seed otherorg/one"},
+		},
+		{
+			name:    "transferred_away",
+			payload: `{"action": "transferred", "changes": {"owner": {"from": {"organization": {"login": "myorg"}}}}, "repository": {"name": "one", "full_name": "someone/one", "owner": {"login": "someone"}, "topics": ["ci-gocd"]}}`,
+			changes: []string{"myorg remove myorg/one (moved)"},
+		},
+		{
+			name:    "other_org",
+			payload: `{"action": "created", "repository": {"name": "one", "full_name": "someone/one", "owner": {"login": "someone"}, "topics": ["ci-gocd"]}}`,
+		},
+	}
+
+	c := newWebhookGH(t)
+
+	for _, tt := range repoEventTests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := c.RepoEvent([]byte(tt.payload))
+			assert.Nil(t, err)
+
+			var got []string
+			for _, change := range changes {
+				moved := ""
+				if change.Moved {
+					moved = " (moved)"
+				}
+				got = append(got, change.Org+" "+change.Action+" "+change.Repo.GetFullName()+moved)
+			}
+			assert.Equal(t, tt.changes, got)
+		})
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	applied := make(chan []gh.Change, 1)
+
+	h, err := gh.NewWebhookHandler(newWebhookGH(t), "s3cr3t", func(changes []gh.Change) {
+		applied <- changes
+	}, log.NewNopLogger())
+	assert.Nil(t, err)
+
+	payload := []byte(`{"action": "created", "repository": {"name": "one", "full_name": "myorg/one", "owner": {"login": "myorg"}, "topics": ["ci-gocd"]}}`)
+
+	var webhookTests = []struct {
+		name      string
+		method    string
+		event     string
+		signature string
+		status    int
+	}{
+		{name: "get", method: http.MethodGet, event: "repository", signature: sign(payload, "s3cr3t"), status: http.StatusMethodNotAllowed},
+		{name: "unsigned", method: http.MethodPost, event: "repository", status: http.StatusUnauthorized},
+		{name: "wrong_secret", method: http.MethodPost, event: "repository", signature: sign(payload, "guessed"), status: http.StatusUnauthorized},
+		{name: "sha1", method: http.MethodPost, event: "repository", signature: "sha1=0123456789abcdef", status: http.StatusUnauthorized},
+		{name: "ping", method: http.MethodPost, event: "ping", signature: sign(payload, "s3cr3t"), status: http.StatusOK},
+		{name: "push", method: http.MethodPost, event: "push", signature: sign(payload, "s3cr3t"), status: http.StatusNoContent},
+		{name: "repository", method: http.MethodPost, event: "repository", signature: sign(payload, "s3cr3t"), status: http.StatusAccepted},
+	}
+
+	for _, tt := range webhookTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/webhooks/github", bytes.NewReader(payload))
+			r.Header.Set("X-GitHub-Event", tt.event)
+			if tt.signature != "" {
+				r.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	changes := <-applied
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, gh.PolicySeed, changes[0].Action)
+		assert.Equal(t, "myorg/one", changes[0].Repo.GetFullName())
+	}
+}
+
+func TestNewWebhookHandlerWithoutSecret(t *testing.T) {
+	h, err := gh.NewWebhookHandler(newWebhookGH(t), "", func([]gh.Change) {}, log.NewNopLogger())
+
+	assert.NotNil(t, err)
+	assert.Nil(t, h)
+}
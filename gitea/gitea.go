@@ -0,0 +1,376 @@
+// Package gitea discovers the repos of Gitea (or Forgejo) orgs that carry a topic.
+package gitea
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// DefaultLimit is the page size used when listing repos, 50 is the maximum Gitea allows by default
+const DefaultLimit = 50
+
+type repository struct {
+	ID            int64    `json:"id"`
+	Name          string   `json:"name"`
+	FullName      string   `json:"full_name"`
+	CloneURL      string   `json:"clone_url"`
+	SSHURL        string   `json:"ssh_url"`
+	DefaultBranch string   `json:"default_branch"`
+	Empty         bool     `json:"empty"`
+	Topics        []string `json:"topics"`
+}
+
+type topics struct {
+	Topics []string `json:"topics"`
+}
+
+type tree struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+	} `json:"tree"`
+	Truncated  bool `json:"truncated"`
+	TotalCount int  `json:"total_count"`
+}
+
+// Gitea provides Gitea funcs
+type Gitea struct {
+	URL               string
+	Token             string
+	TopicMatch        string
+	Limit             int
+	ConfigFilePattern string
+	hc                *http.Client
+	ctx               context.Context
+	logger            log.Logger
+}
+
+// Giteaer provides funcs to retrieve Gitea repos
+type Giteaer interface {
+	OrgRepos(string) ([]*source.Repository, error)
+	HasConfigFile(*source.Repository) (bool, error)
+	FetchFile(*source.Repository, string) ([]byte, bool, error)
+	Branches(*source.Repository) ([]string, error)
+}
+
+// New returns a configured Gitea struct
+func New(ctx context.Context, config map[string]string, hc *http.Client, logger log.Logger) (Giteaer, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	// gitea is always self-hosted
+	if config["GiteaURL"] == "" {
+		return nil, errors.Wrap(errors.New("missing gitea url"), "environment variable not set")
+	}
+
+	// cannot call gitea w/o token
+	if config["GiteaToken"] == "" {
+		return nil, errors.Wrap(errors.New("missing gitea token"), "environment variable not set")
+	}
+
+	topicMatch := config["GiteaTopicMatch"]
+	if topicMatch == "" {
+		topicMatch = "ci-gocd"
+	}
+
+	configFilePattern := config["GiteaConfigFilePattern"]
+	if configFilePattern == "" {
+		configFilePattern = source.DefaultConfigFilePattern
+	}
+	if _, err := path.Match(configFilePattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file pattern %s", configFilePattern)
+	}
+
+	return &Gitea{
+		URL:               strings.TrimSuffix(config["GiteaURL"], "/") + "/api/v1",
+		Token:             config["GiteaToken"],
+		TopicMatch:        topicMatch,
+		Limit:             DefaultLimit,
+		ConfigFilePattern: configFilePattern,
+		hc:                hc,
+		ctx:               ctx,
+		logger:            logger,
+	}, nil
+}
+
+// OrgRepos implements Giteaer and returns the repos of the org that carry the topic
+func (g *Gitea) OrgRepos(org string) ([]*source.Repository, error) {
+
+	var foundRepos = make([]*source.Repository, 0)
+
+	seen := 0
+	for page := 1; ; page++ {
+
+		if err := g.ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "stopped listing gitea repos")
+		}
+
+		var repos []repository
+		query := url.Values{
+			"limit": []string{strconv.Itoa(g.Limit)},
+			"page":  []string{strconv.Itoa(page)},
+		}
+		resp, err := g.get(fmt.Sprintf("orgs/%s/repos?%s", url.PathEscape(org), query.Encode()), &repos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list repos of gitea org %s", org)
+		}
+		seen += len(repos)
+
+		for _, r := range repos {
+
+			// older Gitea versions don't list a repo's topics with the repo
+			if r.Topics == nil {
+				var t topics
+				if _, err := g.get(fmt.Sprintf("repos/%s/topics", escapeFullName(r.FullName)), &t); err != nil {
+					return nil, errors.Wrapf(err, "unable to get topics of %s", r.FullName)
+				}
+				r.Topics = t.Topics
+			}
+
+			if !source.HasTopic(r.Topics, g.TopicMatch) {
+				continue
+			}
+
+			repo := &source.Repository{
+				ID:            strconv.FormatInt(r.ID, 10),
+				Name:          r.Name,
+				FullName:      r.FullName,
+				CloneURL:      r.CloneURL,
+				SSHURL:        r.SSHURL,
+				DefaultBranch: r.DefaultBranch,
+				Topics:        r.Topics,
+			}
+			// gitea reports a default branch for repos that were never pushed to
+			if r.Empty {
+				repo.DefaultBranch = ""
+			}
+
+			foundRepos = append(foundRepos, repo)
+			level.Debug(g.logger).Log("msg", "found repo: "+r.FullName)
+		}
+
+		if lastPage(resp, len(repos), seen) {
+			break
+		}
+	}
+
+	return foundRepos, nil
+}
+
+// HasConfigFile implements Giteaer and checks the repo's branch (see source.Repository.Ref) for a file that matches the config file
+// pattern, see source.MatchConfigFile
+func (g *Gitea) HasConfigFile(repo *source.Repository) (bool, error) {
+
+	// nothing was ever pushed
+	if repo.DefaultBranch == "" {
+		return false, nil
+	}
+
+	seen := 0
+	for page := 1; ; page++ {
+
+		var t tree
+		query := url.Values{
+			"recursive": []string{"true"},
+			"page":      []string{strconv.Itoa(page)},
+		}
+		resp, err := g.get(fmt.Sprintf("repos/%s/git/trees/%s?%s", escapeFullName(repo.FullName), url.PathEscape(repo.Ref()), query.Encode()), &t)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "unable to get tree of %s (%s)", repo.FullName, repo.Ref())
+		}
+
+		for _, entry := range t.Tree {
+			if entry.Type == "blob" && source.MatchConfigFile(repo.ConfigFilePattern(g.ConfigFilePattern), entry.Path) {
+				return true, nil
+			}
+		}
+
+		// gitea pages large trees and marks all but the last page as truncated
+		seen += len(t.Tree)
+		if !t.Truncated || len(t.Tree) == 0 || seen >= t.TotalCount {
+			break
+		}
+	}
+
+	return false, nil
+}
+
+// FetchFile implements Giteaer and returns the content of a file in the repo's default branch
+func (g *Gitea) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+
+	if repo.DefaultBranch == "" {
+		return nil, false, nil
+	}
+
+	var f struct {
+		Type     string `json:"type"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	query := url.Values{"ref": []string{repo.DefaultBranch}}
+	resp, err := g.get(fmt.Sprintf("repos/%s/contents/%s?%s", escapeFullName(repo.FullName), (&url.URL{Path: file}).EscapedPath(), query.Encode()), &f)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to get %s of %s (%s)", file, repo.FullName, repo.DefaultBranch)
+	}
+
+	// e.g. a directory with the file's name
+	if f.Type != "file" {
+		return nil, false, nil
+	}
+	if f.Encoding != "base64" {
+		return []byte(f.Content), true, nil
+	}
+	content, err := base64.StdEncoding.DecodeString(f.Content)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to decode %s of %s", file, repo.FullName)
+	}
+
+	return content, true, nil
+}
+
+// Branches implements Giteaer and returns the names of the repo's branches
+func (g *Gitea) Branches(repo *source.Repository) ([]string, error) {
+
+	var names []string
+	for page := 1; ; page++ {
+
+		var branches []struct {
+			Name string `json:"name"`
+		}
+		query := url.Values{
+			"limit": []string{strconv.Itoa(g.Limit)},
+			"page":  []string{strconv.Itoa(page)},
+		}
+		resp, err := g.get(fmt.Sprintf("repos/%s/branches?%s", escapeFullName(repo.FullName), query.Encode()), &branches)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get branches of %s", repo.FullName)
+		}
+
+		for _, branch := range branches {
+			names = append(names, branch.Name)
+		}
+
+		if lastPage(resp, len(branches), len(names)) {
+			break
+		}
+	}
+
+	return names, nil
+}
+
+// get requests a gitea api path and decodes the response into v
+func (g *Gitea) get(apiPath string, v interface{}) (*http.Response, error) {
+
+	req, err := http.NewRequest(http.MethodGet, g.URL+"/"+apiPath, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating http request")
+	}
+	req = req.WithContext(g.ctx)
+	req.Header.Set("Authorization", "token "+g.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.hc.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error doing http request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, errors.Wrap(err, "error reading response body")
+	}
+
+	if resp.StatusCode > 399 {
+		return resp, errors.Wrap(errors.New(resp.Status), "invalid response status")
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return resp, errors.Wrap(err, "error unmarshaling json from response body")
+	}
+
+	return resp, nil
+}
+
+// lastPage returns true once a listing has no more pages; a short page doesn't mean it's the last one, gitea caps
+// pages at MAX_RESPONSE_ITEMS which can be below the limit we ask for, so we rely on X-Total-Count or an empty page
+func lastPage(resp *http.Response, n int, seen int) bool {
+
+	if n == 0 {
+		return true
+	}
+
+	if total, err := strconv.Atoi(resp.Header.Get("X-Total-Count")); err == nil {
+		return seen >= total
+	}
+
+	return false
+}
+
+// escapeFullName escapes the owner and the name of <owner>/<name> for use in a path
+func escapeFullName(fullName string) string {
+	parts := strings.SplitN(fullName, "/", 2)
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// OrgSource is a source.Source for the repos of a single Gitea org
+type OrgSource struct {
+	gitea Giteaer
+	org   string
+}
+
+// NewOrgSource returns a source.Source for the org's repos
+func NewOrgSource(gitea Giteaer, org string) *OrgSource {
+	return &OrgSource{gitea: gitea, org: org}
+}
+
+// Repos implements source.Source, no repos are ever skipped
+func (s *OrgSource) Repos() ([]*source.Repository, []*source.Repository, error) {
+	repos, err := s.gitea.OrgRepos(s.org)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repos, nil, nil
+}
+
+// HasConfigFile implements source.Source
+func (s *OrgSource) HasConfigFile(repo *source.Repository) (bool, error) {
+	return s.gitea.HasConfigFile(repo)
+}
+
+// Branches implements source.BranchLister
+func (s *OrgSource) Branches(repo *source.Repository) ([]string, error) {
+	return s.gitea.Branches(repo)
+}
+
+// FetchFile implements source.FileFetcher
+func (s *OrgSource) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+	return s.gitea.FetchFile(repo, file)
+}
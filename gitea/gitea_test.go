@@ -0,0 +1,200 @@
+package gitea_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gitea"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithoutToken(t *testing.T) {
+	g, err := gitea.New(nil, map[string]string{"GiteaURL": "https://gitea.example.com"}, nil, log.NewNopLogger())
+
+	assert.NotNil(t, err)
+	assert.Nil(t, g)
+}
+
+func TestOrgRepos(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "token aabbcc", r.Header.Get("Authorization"))
+
+			switch r.URL.Path {
+			case "/api/v1/orgs/edge/repos":
+				assert.Equal(t, "2", r.URL.Query().Get("limit"))
+				switch r.URL.Query().Get("page") {
+				case "1":
+					fmt.Fprintf(w, `[
+						{"id": 1, "name": "one", "full_name": "edge/one", "clone_url": "https://gitea.example.com/edge/one.git", "ssh_url": "git@gitea.example.com:edge/one.git", "default_branch": "main", "topics": ["ci-gocd"]},
+						{"id": 2, "name": "two", "full_name": "edge/two", "clone_url": "https://gitea.example.com/edge/two.git", "default_branch": "main", "topics": []}
+					]`)
+				case "2":
+					fmt.Fprintf(w, `[
+						{"id": 3, "name": "three", "full_name": "edge/three", "clone_url": "https://gitea.example.com/edge/three.git", "default_branch": "main", "empty": true}
+					]`)
+				case "3":
+					fmt.Fprintf(w, `[]`)
+				default:
+					t.Fatalf("unexpected page %s", r.URL.Query().Get("page"))
+				}
+			case "/api/v1/repos/edge/three/topics":
+				fmt.Fprintf(w, `{"topics": ["ci-gocd"]}`)
+			default:
+				t.Fatalf("unexpected path %s", r.URL.Path)
+			}
+		}))
+	defer hs.Close()
+
+	g, err := gitea.New(
+		context.Background(),
+		map[string]string{
+			"GiteaURL":   hs.URL,
+			"GiteaToken": "aabbcc",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+	g.(*gitea.Gitea).Limit = 2
+
+	repos, err := g.OrgRepos("edge")
+	assert.Nil(t, err)
+	assert.Equal(t, []*source.Repository{
+		{
+			ID:            "1",
+			Name:          "one",
+			FullName:      "edge/one",
+			CloneURL:      "https://gitea.example.com/edge/one.git",
+			SSHURL:        "git@gitea.example.com:edge/one.git",
+			DefaultBranch: "main",
+			Topics:        []string{"ci-gocd"},
+		},
+		{
+			ID:       "3",
+			Name:     "three",
+			FullName: "edge/three",
+			CloneURL: "https://gitea.example.com/edge/three.git",
+			Topics:   []string{"ci-gocd"},
+		},
+	}, repos)
+}
+
+func TestOrgReposCappedPages(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the server caps every page at a single item (MAX_RESPONSE_ITEMS=1), whatever limit we ask for
+			page := r.URL.Query().Get("page")
+			switch r.URL.Path {
+			case "/api/v1/orgs/edge/repos":
+				w.Header().Set("X-Total-Count", "3")
+				switch page {
+				case "1", "2", "3":
+					fmt.Fprintf(w, `[{"id": %s, "name": "r%s", "full_name": "edge/r%s", "default_branch": "main", "topics": ["ci-gocd"]}]`, page, page, page)
+				default:
+					t.Fatalf("unexpected page %s", page)
+				}
+			case "/api/v1/repos/edge/r1/branches":
+				// no X-Total-Count, paging stops at the first empty page
+				switch page {
+				case "1", "2":
+					fmt.Fprintf(w, `[{"name": "b%s"}]`, page)
+				default:
+					fmt.Fprintf(w, `[]`)
+				}
+			default:
+				t.Fatalf("unexpected path %s", r.URL.Path)
+			}
+		}))
+	defer hs.Close()
+
+	g, err := gitea.New(
+		context.Background(),
+		map[string]string{
+			"GiteaURL":   hs.URL,
+			"GiteaToken": "aabbcc",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	repos, err := g.OrgRepos("edge")
+	assert.Nil(t, err)
+	if assert.Len(t, repos, 3) {
+		assert.Equal(t, "edge/r3", repos[2].FullName)
+	}
+
+	branches, err := g.Branches(&source.Repository{FullName: "edge/r1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b1", "b2"}, branches)
+}
+
+func TestOrgReposError(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+	defer hs.Close()
+
+	g, err := gitea.New(
+		context.Background(),
+		map[string]string{
+			"GiteaURL":   hs.URL,
+			"GiteaToken": "aabbcc",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	_, err = g.OrgRepos("edge")
+	assert.Regexp(t, "invalid response status: 403 Forbidden$", err)
+}
+
+func TestHasConfigFile(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v1/repos/edge/one/git/trees/main":
+				if r.URL.Query().Get("page") == "1" {
+					fmt.Fprintf(w, `{"tree": [{"path": "README.md", "type": "blob"}], "truncated": true, "total_count": 3}`)
+					return
+				}
+				fmt.Fprintf(w, `{"tree": [{"path": "ci", "type": "tree"}, {"path": "ci/ci.gocd.yaml", "type": "blob"}], "total_count": 3}`)
+			case "/api/v1/repos/edge/two/git/trees/main":
+				fmt.Fprintf(w, `{"tree": [{"path": "README.md", "type": "blob"}], "total_count": 1}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	g, err := gitea.New(
+		context.Background(),
+		map[string]string{
+			"GiteaURL":   hs.URL,
+			"GiteaToken": "aabbcc",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	configured, err := g.HasConfigFile(&source.Repository{FullName: "edge/one", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.True(t, configured)
+
+	configured, err = g.HasConfigFile(&source.Repository{FullName: "edge/two", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.False(t, configured)
+
+	configured, err = g.HasConfigFile(&source.Repository{FullName: "edge/gone", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.False(t, configured)
+}
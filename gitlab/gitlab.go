@@ -0,0 +1,337 @@
+// Package gitlab discovers the projects of GitLab groups that carry a topic.
+package gitlab
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// DefaultURL is the url of gitlab.com
+const DefaultURL = "https://gitlab.com"
+
+// DefaultPerPage is the page size used when listing projects, 100 is the maximum GitLab allows
+const DefaultPerPage = 100
+
+type project struct {
+	ID                int64    `json:"id"`
+	PathWithNamespace string   `json:"path_with_namespace"`
+	DefaultBranch     string   `json:"default_branch"`
+	HTTPURLToRepo     string   `json:"http_url_to_repo"`
+	SSHURLToRepo      string   `json:"ssh_url_to_repo"`
+	Topics            []string `json:"topics"`
+	TagList           []string `json:"tag_list"`
+}
+
+type treeEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+}
+
+// GitLab provides GitLab funcs
+type GitLab struct {
+	URL               string
+	Token             string
+	TopicMatch        string
+	PerPage           int
+	ConfigFilePattern string
+	hc                *http.Client
+	ctx               context.Context
+	logger            log.Logger
+}
+
+// GitLabber provides funcs to retrieve GitLab projects
+type GitLabber interface {
+	GroupRepos(string) ([]*source.Repository, error)
+	HasConfigFile(*source.Repository) (bool, error)
+	FetchFile(*source.Repository, string) ([]byte, bool, error)
+	Branches(*source.Repository) ([]string, error)
+}
+
+// New returns a configured GitLab struct
+func New(ctx context.Context, config map[string]string, hc *http.Client, logger log.Logger) (GitLabber, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	// cannot call gitlab w/o token
+	if config["GitLabToken"] == "" {
+		return nil, errors.Wrap(errors.New("missing gitlab token"), "environment variable not set")
+	}
+
+	gitlabURL := config["GitLabURL"]
+	if gitlabURL == "" {
+		gitlabURL = DefaultURL
+	}
+
+	topicMatch := config["GitLabTopicMatch"]
+	if topicMatch == "" {
+		topicMatch = "ci-gocd"
+	}
+
+	configFilePattern := config["GitLabConfigFilePattern"]
+	if configFilePattern == "" {
+		configFilePattern = source.DefaultConfigFilePattern
+	}
+	if _, err := path.Match(configFilePattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file pattern %s", configFilePattern)
+	}
+
+	return &GitLab{
+		URL:               strings.TrimSuffix(gitlabURL, "/") + "/api/v4",
+		Token:             config["GitLabToken"],
+		TopicMatch:        topicMatch,
+		PerPage:           DefaultPerPage,
+		ConfigFilePattern: configFilePattern,
+		hc:                hc,
+		ctx:               ctx,
+		logger:            logger,
+	}, nil
+}
+
+// GroupRepos implements GitLabber and returns the projects of the group, including its subgroups, that carry the topic
+func (g *GitLab) GroupRepos(group string) ([]*source.Repository, error) {
+
+	var foundRepos = make([]*source.Repository, 0)
+
+	// names of the found projects, to tell apart projects whose paths only differ in "/" vs "-"
+	names := make(map[string]string)
+
+	query := url.Values{
+		"include_subgroups": []string{"true"},
+		"topic":             []string{g.TopicMatch},
+		"per_page":          []string{strconv.Itoa(g.PerPage)},
+	}
+
+	next := "1"
+	for next != "" {
+
+		if err := g.ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "stopped listing gitlab projects")
+		}
+
+		query.Set("page", next)
+
+		var projects []project
+		resp, err := g.get(fmt.Sprintf("groups/%s/projects?%s", url.PathEscape(group), query.Encode()), &projects)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list projects of gitlab group %s", group)
+		}
+		next = resp.Header.Get("X-Next-Page")
+
+		for _, p := range projects {
+
+			// older GitLab versions ignore the topic parameter and call topics tags
+			if !source.HasTopic(p.Topics, g.TopicMatch) && !source.HasTopic(p.TagList, g.TopicMatch) {
+				continue
+			}
+
+			// projects in different subgroups can have the same name, so the subgroups are part of the name; "-" is
+			// also valid within a path, so e.g. a/b-c and a-b/c end up with the same name and would share a config repo
+			name := strings.Replace(strings.TrimPrefix(p.PathWithNamespace, group+"/"), "/", "-", -1)
+			if other, ok := names[name]; ok {
+				return nil, fmt.Errorf("gitlab projects %s and %s both map to the name %s", other, p.PathWithNamespace, name)
+			}
+			names[name] = p.PathWithNamespace
+
+			foundRepos = append(foundRepos, &source.Repository{
+				ID:            strconv.FormatInt(p.ID, 10),
+				Name:          name,
+				FullName:      p.PathWithNamespace,
+				CloneURL:      p.HTTPURLToRepo,
+				SSHURL:        p.SSHURLToRepo,
+				DefaultBranch: p.DefaultBranch,
+				Topics:        p.Topics,
+			})
+			level.Debug(g.logger).Log("msg", "found project: "+p.PathWithNamespace)
+		}
+	}
+
+	return foundRepos, nil
+}
+
+// HasConfigFile implements GitLabber and checks the project's branch (see source.Repository.Ref) for a file that matches the config
+// file pattern, see source.MatchConfigFile
+func (g *GitLab) HasConfigFile(repo *source.Repository) (bool, error) {
+
+	// nothing was ever pushed
+	if repo.DefaultBranch == "" {
+		return false, nil
+	}
+
+	query := url.Values{
+		"recursive": []string{"true"},
+		"ref":       []string{repo.Ref()},
+		"per_page":  []string{strconv.Itoa(g.PerPage)},
+	}
+
+	next := "1"
+	for next != "" {
+
+		query.Set("page", next)
+
+		var entries []treeEntry
+		resp, err := g.get(fmt.Sprintf("projects/%s/repository/tree?%s", repo.ID, query.Encode()), &entries)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "unable to get tree of %s (%s)", repo.FullName, repo.Ref())
+		}
+		next = resp.Header.Get("X-Next-Page")
+
+		for _, entry := range entries {
+			if entry.Type == "blob" && source.MatchConfigFile(repo.ConfigFilePattern(g.ConfigFilePattern), entry.Path) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// FetchFile implements GitLabber and returns the content of a file in the project's default branch
+func (g *GitLab) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+
+	if repo.DefaultBranch == "" {
+		return nil, false, nil
+	}
+
+	var f struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	// the files api wants the whole file path as a single path segment, PathEscape leaves "/" as is
+	query := url.Values{"ref": []string{repo.DefaultBranch}}
+	escaped := strings.Replace(url.PathEscape(file), "/", "%2F", -1)
+	resp, err := g.get(fmt.Sprintf("projects/%s/repository/files/%s?%s", repo.ID, escaped, query.Encode()), &f)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to get %s of %s (%s)", file, repo.FullName, repo.DefaultBranch)
+	}
+
+	if f.Encoding != "base64" {
+		return []byte(f.Content), true, nil
+	}
+	content, err := base64.StdEncoding.DecodeString(f.Content)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to decode %s of %s", file, repo.FullName)
+	}
+
+	return content, true, nil
+}
+
+// Branches implements GitLabber and returns the names of the project's branches
+func (g *GitLab) Branches(repo *source.Repository) ([]string, error) {
+
+	query := url.Values{"per_page": []string{strconv.Itoa(g.PerPage)}}
+
+	var names []string
+	next := "1"
+	for next != "" {
+
+		query.Set("page", next)
+
+		var branches []struct {
+			Name string `json:"name"`
+		}
+		resp, err := g.get(fmt.Sprintf("projects/%s/repository/branches?%s", repo.ID, query.Encode()), &branches)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get branches of %s", repo.FullName)
+		}
+		next = resp.Header.Get("X-Next-Page")
+
+		for _, branch := range branches {
+			names = append(names, branch.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// get requests a gitlab api path and decodes the response into v
+func (g *GitLab) get(path string, v interface{}) (*http.Response, error) {
+
+	req, err := http.NewRequest(http.MethodGet, g.URL+"/"+path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating http request")
+	}
+	req = req.WithContext(g.ctx)
+	req.Header.Set("PRIVATE-TOKEN", g.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.hc.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error doing http request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, errors.Wrap(err, "error reading response body")
+	}
+
+	if resp.StatusCode > 399 {
+		return resp, errors.Wrap(errors.New(resp.Status), "invalid response status")
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return resp, errors.Wrap(err, "error unmarshaling json from response body")
+	}
+
+	return resp, nil
+}
+
+// GroupSource is a source.Source for the projects of a single GitLab group
+type GroupSource struct {
+	gitlab GitLabber
+	group  string
+}
+
+// NewGroupSource returns a source.Source for the group's projects
+func NewGroupSource(gitlab GitLabber, group string) *GroupSource {
+	return &GroupSource{gitlab: gitlab, group: group}
+}
+
+// Repos implements source.Source, no projects are ever skipped
+func (s *GroupSource) Repos() ([]*source.Repository, []*source.Repository, error) {
+	repos, err := s.gitlab.GroupRepos(s.group)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repos, nil, nil
+}
+
+// HasConfigFile implements source.Source
+func (s *GroupSource) HasConfigFile(repo *source.Repository) (bool, error) {
+	return s.gitlab.HasConfigFile(repo)
+}
+
+// Branches implements source.BranchLister
+func (s *GroupSource) Branches(repo *source.Repository) ([]string, error) {
+	return s.gitlab.Branches(repo)
+}
+
+// FetchFile implements source.FileFetcher
+func (s *GroupSource) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+	return s.gitlab.FetchFile(repo, file)
+}
@@ -0,0 +1,197 @@
+package gitlab_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gitlab"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithoutToken(t *testing.T) {
+	g, err := gitlab.New(nil, map[string]string{}, nil, log.NewNopLogger())
+
+	assert.NotNil(t, err)
+	assert.Nil(t, g)
+}
+
+func TestGroupRepos(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/v4/groups/platform/projects", r.URL.Path)
+			assert.Equal(t, "s3cr3t", r.Header.Get("PRIVATE-TOKEN"))
+			assert.Equal(t, "true", r.URL.Query().Get("include_subgroups"))
+
+			switch r.URL.Query().Get("page") {
+			case "1":
+				w.Header().Set("X-Next-Page", "2")
+				fmt.Fprintf(w, `[
+					{"id": 1, "path_with_namespace": "platform/one", "default_branch": "main", "http_url_to_repo": "https://gitlab.example.com/platform/one.git", "topics": ["ci-gocd"]},
+					{"id": 2, "path_with_namespace": "platform/two", "default_branch": "main", "http_url_to_repo": "https://gitlab.example.com/platform/two.git", "topics": ["other"]}
+				]`)
+			case "2":
+				w.Header().Set("X-Next-Page", "")
+				fmt.Fprintf(w, `[
+					{"id": 3, "path_with_namespace": "platform/team-a/svc", "default_branch": "master", "http_url_to_repo": "https://gitlab.example.com/platform/team-a/svc.git", "tag_list": ["ci-gocd"]}
+				]`)
+			default:
+				t.Fatalf("unexpected page %s", r.URL.Query().Get("page"))
+			}
+		}))
+	defer hs.Close()
+
+	g, err := gitlab.New(
+		context.Background(),
+		map[string]string{
+			"GitLabURL":   hs.URL,
+			"GitLabToken": "s3cr3t",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	repos, err := g.GroupRepos("platform")
+	assert.Nil(t, err)
+	assert.Equal(t, []*source.Repository{
+		{
+			ID:            "1",
+			Name:          "one",
+			FullName:      "platform/one",
+			CloneURL:      "https://gitlab.example.com/platform/one.git",
+			DefaultBranch: "main",
+			Topics:        []string{"ci-gocd"},
+		},
+		{
+			ID:            "3",
+			Name:          "team-a-svc",
+			FullName:      "platform/team-a/svc",
+			CloneURL:      "https://gitlab.example.com/platform/team-a/svc.git",
+			DefaultBranch: "master",
+		},
+	}, repos)
+}
+
+func TestGroupReposError(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+	defer hs.Close()
+
+	g, err := gitlab.New(
+		context.Background(),
+		map[string]string{
+			"GitLabURL":   hs.URL,
+			"GitLabToken": "s3cr3t",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	_, err = g.GroupRepos("platform")
+	assert.Regexp(t, "invalid response status: 401 Unauthorized$", err)
+}
+
+func TestGroupReposNameCollision(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `[
+				{"id": 1, "path_with_namespace": "platform/a/b-c", "default_branch": "main", "topics": ["ci-gocd"]},
+				{"id": 2, "path_with_namespace": "platform/a-b/c", "default_branch": "main", "topics": ["ci-gocd"]}
+			]`)
+		}))
+	defer hs.Close()
+
+	g, err := gitlab.New(
+		context.Background(),
+		map[string]string{
+			"GitLabURL":   hs.URL,
+			"GitLabToken": "s3cr3t",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	_, err = g.GroupRepos("platform")
+	assert.EqualError(t, err, "gitlab projects platform/a/b-c and platform/a-b/c both map to the name a-b-c")
+}
+
+func TestHasConfigFile(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v4/projects/1/repository/tree":
+				assert.Equal(t, "main", r.URL.Query().Get("ref"))
+				if r.URL.Query().Get("page") == "1" {
+					w.Header().Set("X-Next-Page", "2")
+					fmt.Fprintf(w, `[{"path": "README.md", "type": "blob"}]`)
+					return
+				}
+				fmt.Fprintf(w, `[{"path": "ci", "type": "tree"}, {"path": "ci/ci.gocd.yaml", "type": "blob"}]`)
+			case "/api/v4/projects/2/repository/tree":
+				fmt.Fprintf(w, `[{"path": "README.md", "type": "blob"}]`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	g, err := gitlab.New(
+		context.Background(),
+		map[string]string{
+			"GitLabURL":   hs.URL,
+			"GitLabToken": "s3cr3t",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	configured, err := g.HasConfigFile(&source.Repository{ID: "1", FullName: "platform/one", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.True(t, configured)
+
+	configured, err = g.HasConfigFile(&source.Repository{ID: "2", FullName: "platform/two", DefaultBranch: "main"})
+	assert.Nil(t, err)
+	assert.False(t, configured)
+
+	// empty projects have no default branch
+	configured, err = g.HasConfigFile(&source.Repository{ID: "3", FullName: "platform/three"})
+	assert.Nil(t, err)
+	assert.False(t, configured)
+}
+
+func TestFetchFile(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the file path must arrive as a single, fully escaped path segment
+			assert.Equal(t, "/api/v4/projects/1/repository/files/ci%2Fci.gocd.yaml", r.URL.EscapedPath())
+			assert.Equal(t, "main", r.URL.Query().Get("ref"))
+			fmt.Fprintf(w, `{"content": "Zm9ybWF0X3ZlcnNpb246IDEw", "encoding": "base64"}`)
+		}))
+	defer hs.Close()
+
+	g, err := gitlab.New(
+		context.Background(),
+		map[string]string{
+			"GitLabURL":   hs.URL,
+			"GitLabToken": "s3cr3t",
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+	assert.Nil(t, err)
+
+	content, found, err := g.FetchFile(&source.Repository{ID: "1", FullName: "platform/one", DefaultBranch: "main"}, "ci/ci.gocd.yaml")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "format_version: 10", string(content))
+}
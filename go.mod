@@ -1,5 +1,7 @@
 module github.com/alex-leonhardt/gocd-seeder
 
+go 1.13
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-kit/kit v0.7.0
@@ -12,4 +14,5 @@ require (
 	github.com/stretchr/testify v1.2.2
 	golang.org/x/net v0.0.0-20181102091132-c10e9556a7bc // indirect
 	golang.org/x/oauth2 v0.0.0-20181102170140-232e45548389
+	gopkg.in/yaml.v2 v2.4.0
 )
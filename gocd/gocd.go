@@ -3,25 +3,67 @@ package gocd
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/alex-leonhardt/gocd-seeder/source"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
 )
 
+// DefaultBranch is the branch config repos read pipelines from when the repo has no default branch (yet), and
+// neither the repo nor the seeder set one
+const DefaultBranch = "master"
+
+// DefaultPluginID is the plugin that parses config repos, unless the repo sets its own
+const DefaultPluginID = "yaml.config.plugin"
+
+const (
+	// ProtocolHTTPS makes config repos clone their repo over https, the default
+	ProtocolHTTPS = "https"
+	// ProtocolSSH makes config repos clone their repo over ssh, GoCD needs a key the repo accepts
+	ProtocolSSH = "ssh"
+)
+
+// filePatternKeys are the plugins' configuration keys for the pattern of the files they read pipelines from
+var filePatternKeys = map[string]string{
+	"yaml.config.plugin": "file_pattern",
+	"json.config.plugin": "pipeline_pattern",
+}
+
+type configurationProperty struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 type repoAttributes struct {
-	URL        string `json:"url"`
-	Name       string `json:"name,omitempty"`
-	Branch     string `json:"branch"`
-	AutoUpdate bool   `json:"auto_update"`
+	URL               string `json:"url"`
+	Name              string `json:"name,omitempty"`
+	Branch            string `json:"branch"`
+	AutoUpdate        bool   `json:"auto_update"`
+	Username          string `json:"username,omitempty"`
+	EncryptedPassword string `json:"encrypted_password,omitempty"`
+}
+
+type encryptRequest struct {
+	Value string `json:"value"`
 }
 
+type encryptResponse struct {
+	EncryptedValue string `json:"encrypted_value"`
+}
+
+// maxEncrypted is how many encrypted passwords are kept, tokens are rotated every hour or so
+const maxEncrypted = 100
+
 type repoMaterial struct {
 	Type       string         `json:"type"`
 	Attributes repoAttributes `json:"attributes"`
@@ -34,6 +76,8 @@ type ConfigRepo struct {
 	PluginID      string                       `json:"plugin_id"`
 	Material      repoMaterial                 `json:"material"`
 	Configuration []interface{}                `json:"configuration,omitempty"`
+	// ETag is the version of the config repo as it was retrieved, GoCD only updates the version it was given
+	ETag string `json:"-"`
 }
 
 // AllConfigRepos contains the response from GoCD containing all config repos
@@ -53,15 +97,28 @@ type GoCD struct {
 	URL      string
 	User     string
 	Password string
-	hc       *http.Client
-	logger   log.Logger
+	Branch   string
+	// CloneProtocol is ProtocolHTTPS or ProtocolSSH
+	CloneProtocol string
+	// encrypted holds the encrypted passwords by the password's hash, GoCD encrypts the same value differently each
+	// time, config repos would be updated on every cycle otherwise
+	encrypted   map[string]string
+	encryptedMu sync.Mutex
+	// filePatterns holds the ids of the config repos the seeder set a file pattern on, only those are changed or
+	// removed w/o an override, file patterns set by hand are kept; it's lost on restarts, a file pattern whose
+	// override was removed meanwhile is kept then
+	filePatterns   map[string]bool
+	filePatternsMu sync.Mutex
+	hc             *http.Client
+	logger         log.Logger
 }
 
 // ConfigRepoInterface provides implementations that interact with GoCD
 type ConfigRepoInterface interface {
 	GetConfigRepos() ([]ConfigRepo, error)
-	GetConfigRepo(*github.Repository, string) (ConfigRepo, error)
-	CreateConfigRepo(*github.Repository, string) (ConfigRepo, error)
+	GetConfigRepo(*source.Repository, string) (ConfigRepo, error)
+	CreateConfigRepo(*source.Repository, string) (ConfigRepo, error)
+	UpdateConfigRepo(ConfigRepo, *source.Repository, string) (ConfigRepo, bool, error)
 	DeleteConfigRepo(*ConfigRepo, string) (*http.Response, error)
 }
 
@@ -131,15 +188,9 @@ func (g *GoCD) GetConfigRepos() ([]ConfigRepo, error) {
 }
 
 // GetConfigRepo retrieves an existing config repo
-func (g *GoCD) GetConfigRepo(repo *github.Repository, prefix string) (ConfigRepo, error) {
-
-	if prefix != "" {
-		prefix = fmt.Sprintf("%s-", prefix)
-	}
-
-	id := fmt.Sprintf("%s%s", prefix, *repo.Name)
+func (g *GoCD) GetConfigRepo(repo *source.Repository, prefix string) (ConfigRepo, error) {
 
-	req, err := g.NewRequest(http.MethodGet, id, nil, nil)
+	req, err := g.NewRequest(http.MethodGet, ConfigRepoID(repo, prefix), nil, nil)
 	if err != nil {
 		return ConfigRepo{}, errors.Wrap(err, "error creating request to retrieve gocd config repo")
 	}
@@ -159,28 +210,39 @@ func (g *GoCD) GetConfigRepo(repo *github.Repository, prefix string) (ConfigRepo
 	var cfgrepo ConfigRepo
 	jd := json.NewDecoder(resp.Body)
 	jd.Decode(&cfgrepo)
+	cfgrepo.ETag = resp.Header.Get("ETag")
 	return cfgrepo, nil
 }
 
 // CreateConfigRepo creates a previously non-existent config repo
-func (g *GoCD) CreateConfigRepo(repo *github.Repository, prefix string) (ConfigRepo, error) {
+func (g *GoCD) CreateConfigRepo(repo *source.Repository, prefix string) (ConfigRepo, error) {
 
-	if prefix != "" {
-		prefix = fmt.Sprintf("%s-", prefix)
+	name := repo.MaterialName
+	if name == "" {
+		name = repo.Name
+	}
+
+	url := g.cloneURL(repo)
+	username, encryptedPassword, err := g.credentials(repo, url)
+	if err != nil {
+		return ConfigRepo{}, err
 	}
 
 	newRepoConfig := ConfigRepo{
-		ID:       fmt.Sprintf("%s%s", prefix, *repo.Name),
-		PluginID: "yaml.config.plugin",
+		ID:       ConfigRepoID(repo, prefix),
+		PluginID: pluginID(repo),
 		Material: repoMaterial{
 			Type: "git",
 			Attributes: repoAttributes{
-				AutoUpdate: true,
-				Branch:     "master",
-				Name:       *repo.Name,
-				URL:        *repo.CloneURL,
+				AutoUpdate:        autoUpdate(repo),
+				Branch:            g.branch(repo),
+				Name:              name,
+				URL:               url,
+				Username:          username,
+				EncryptedPassword: encryptedPassword,
 			},
 		},
+		Configuration: configuration(nil, repo, false),
 	}
 
 	postBody, err := json.Marshal(newRepoConfig)
@@ -211,9 +273,307 @@ func (g *GoCD) CreateConfigRepo(repo *github.Repository, prefix string) (ConfigR
 	jd := json.NewDecoder(resp.Body)
 	jd.Decode(&cfgrepo)
 
+	g.setFilePattern(newRepoConfig.ID, repo)
+
 	return cfgrepo, nil
 }
 
+// UpdateConfigRepo brings an existing config repo in line with the repo, e.g. after it was renamed or its overrides
+// changed; it returns false if the config repo was up to date already
+func (g *GoCD) UpdateConfigRepo(existing ConfigRepo, repo *source.Repository, prefix string) (ConfigRepo, bool, error) {
+
+	attributes := &existing.Material.Attributes
+	url := g.movedURL(attributes.URL, repo)
+
+	username, encryptedPassword, err := g.credentials(repo, url)
+	if err != nil {
+		return ConfigRepo{}, false, err
+	}
+
+	// credentials set by hand are left alone, unless the seeder has credentials of its own for the repo
+	if encryptedPassword == "" {
+		username, encryptedPassword = attributes.Username, attributes.EncryptedPassword
+	}
+
+	name := repo.MaterialName
+	if name == "" {
+		name = repo.Name
+	}
+
+	branch := g.branch(repo)
+	plugin := pluginID(repo)
+	update := autoUpdate(repo)
+	config := configuration(existing.Configuration, repo, g.hasFilePattern(existing.ID))
+	if attributes.URL == url && attributes.Name == name && attributes.Branch == branch &&
+		attributes.Username == username && attributes.EncryptedPassword == encryptedPassword &&
+		existing.PluginID == plugin && attributes.AutoUpdate == update && sameConfiguration(existing.Configuration, config) {
+		g.setFilePattern(existing.ID, repo)
+		return existing, false, nil
+	}
+	attributes.URL = url
+	attributes.Name = name
+	attributes.Branch = branch
+	attributes.Username = username
+	attributes.EncryptedPassword = encryptedPassword
+	existing.PluginID = plugin
+	attributes.AutoUpdate = update
+	existing.Configuration = config
+
+	putBody, err := json.Marshal(existing)
+	if err != nil {
+		return ConfigRepo{}, false, errors.Wrap(err, "error marshalling json to update gocd config repo")
+	}
+
+	headers := http.Header{
+		"Accept":       []string{"application/vnd.go.cd.v1+json"},
+		"Content-Type": []string{"application/json"},
+		"If-Match":     []string{existing.ETag},
+	}
+
+	req, err := g.NewRequest(http.MethodPut, existing.ID, headers, bytes.NewBuffer(putBody))
+	if err != nil {
+		return ConfigRepo{}, false, errors.Wrap(err, "error creating http put request")
+	}
+
+	resp, err := g.hc.Do(req)
+	if err != nil {
+		return ConfigRepo{}, false, errors.Wrap(err, "error executing http put request")
+	}
+	defer resp.Body.Close()
+
+	// a 412 Precondition Failed means someone else changed it, it is updated again next time
+	if resp.StatusCode > 399 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return ConfigRepo{}, false, errors.Wrap(errors.New("invalid response status"), fmt.Sprintf("%v %v", resp.Status, string(msg)))
+	}
+
+	var cfgrepo ConfigRepo
+	jd := json.NewDecoder(resp.Body)
+	jd.Decode(&cfgrepo)
+	cfgrepo.ETag = resp.Header.Get("ETag")
+
+	g.setFilePattern(existing.ID, repo)
+
+	return cfgrepo, true, nil
+}
+
+// pluginID returns the plugin that parses the repo's config repo
+func pluginID(repo *source.Repository) string {
+	if repo.PluginID != "" {
+		return repo.PluginID
+	}
+	return DefaultPluginID
+}
+
+// autoUpdate returns whether GoCD polls the repo's config repo for changes, it does unless the repo says otherwise
+func autoUpdate(repo *source.Repository) bool {
+	if repo.AutoUpdate != nil {
+		return *repo.AutoUpdate
+	}
+	return true
+}
+
+// configuration returns the existing configuration with the file pattern of the repo's plugin set to the repo's file
+// pattern; other plugins don't know about file patterns, or call them something we can't guess, and properties set
+// by hand are kept; owned is true if the seeder set the existing file pattern, w/o it and an override of the repo's
+// the existing file pattern was set by hand and is kept too
+func configuration(existing []interface{}, repo *source.Repository, owned bool) []interface{} {
+
+	if repo.FilePattern == "" && !owned {
+		return existing
+	}
+
+	key, ok := filePatternKeys[pluginID(repo)]
+	pattern := configurationProperty{Key: key, Value: repo.FilePattern}
+	pending := ok && repo.FilePattern != ""
+
+	var config []interface{}
+	for _, property := range existing {
+
+		// file patterns are the seeder's, incl. the one of the plugin the config repo used before; the repo's own
+		// takes the place of the first one, so an unchanged configuration stays in the same order
+		if isFilePatternKey(propertyKey(property)) {
+			if pending {
+				config = append(config, pattern)
+				pending = false
+			}
+			continue
+		}
+		config = append(config, property)
+	}
+
+	if pending {
+		config = append(config, pattern)
+	}
+
+	return config
+}
+
+// hasFilePattern returns true if the seeder set the file pattern of the config repo with the id
+func (g *GoCD) hasFilePattern(id string) bool {
+	g.filePatternsMu.Lock()
+	defer g.filePatternsMu.Unlock()
+	return g.filePatterns[id]
+}
+
+// setFilePattern records whether the seeder set a file pattern on the repo's config repo with the id
+func (g *GoCD) setFilePattern(id string, repo *source.Repository) {
+	g.filePatternsMu.Lock()
+	defer g.filePatternsMu.Unlock()
+
+	if repo.FilePattern == "" {
+		delete(g.filePatterns, id)
+		return
+	}
+	g.filePatterns[id] = true
+}
+
+// propertyKey returns the key of a configuration property as decoded from GoCD's json
+func propertyKey(property interface{}) string {
+	if p, ok := property.(map[string]interface{}); ok {
+		key, _ := p["key"].(string)
+		return key
+	}
+	return ""
+}
+
+func isFilePatternKey(key string) bool {
+	for _, k := range filePatternKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sameConfiguration compares configurations by their json, properties decoded from GoCD are maps rather than
+// configurationProperty
+func sameConfiguration(a []interface{}, b []interface{}) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// credentials returns the username and encrypted password the repo is cloned with from the url, both are empty when
+// it's cloned w/o credentials or over ssh
+func (g *GoCD) credentials(repo *source.Repository, url string) (string, string, error) {
+
+	if repo.Password == "" || url != repo.CloneURL {
+		return "", "", nil
+	}
+
+	hash := sha256.Sum256([]byte(repo.Password))
+	key := hex.EncodeToString(hash[:])
+
+	g.encryptedMu.Lock()
+	encrypted, ok := g.encrypted[key]
+	g.encryptedMu.Unlock()
+	if ok {
+		return repo.Username, encrypted, nil
+	}
+
+	encrypted, err := g.Encrypt(repo.Password)
+	if err != nil {
+		return "", "", errors.Wrap(err, "unable to encrypt password of "+repo.FullName)
+	}
+
+	g.encryptedMu.Lock()
+	defer g.encryptedMu.Unlock()
+	if len(g.encrypted) >= maxEncrypted {
+		g.encrypted = map[string]string{}
+	}
+	g.encrypted[key] = encrypted
+
+	return repo.Username, encrypted, nil
+}
+
+// Encrypt encrypts the value with GoCD's cipher, e.g. for a material's encrypted_password
+func (g *GoCD) Encrypt(value string) (string, error) {
+
+	body, err := json.Marshal(encryptRequest{Value: value})
+	if err != nil {
+		return "", errors.Wrap(err, "error marshalling json to encrypt a value")
+	}
+
+	// the encryption api is next to the config repos api
+	req, err := g.NewRequest(http.MethodPost, "", nil, bytes.NewBuffer(body))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating http post request")
+	}
+	req.URL.Path = strings.TrimSuffix(req.URL.Path, "config_repos") + "encrypt"
+
+	resp, err := g.hc.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error executing http post request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 399 {
+		return "", errors.Wrap(errors.New(resp.Status), "invalid response status")
+	}
+
+	var encrypted encryptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&encrypted); err != nil {
+		return "", errors.Wrap(err, "error unmarshaling json from response body")
+	}
+	if encrypted.EncryptedValue == "" {
+		return "", errors.New("gocd returned no encrypted value")
+	}
+
+	return encrypted.EncryptedValue, nil
+}
+
+// cloneURL returns the url the repo's config repo clones it from, repos w/o an ssh url (e.g. from a manifest) are
+// always cloned over https
+func (g *GoCD) cloneURL(repo *source.Repository) string {
+	if g.CloneProtocol == ProtocolSSH && repo.SSHURL != "" {
+		return repo.SSHURL
+	}
+	return repo.CloneURL
+}
+
+// movedURL returns the url an existing config repo clones the repo from: the one it has, unless the repo was renamed
+// or transferred since, then the repo's url of the same protocol; the url of a config repo that was created before
+// the protocol was changed keeps working, e.g. it has no deploy key to clone with over ssh
+func (g *GoCD) movedURL(current string, repo *source.Repository) string {
+	switch {
+	case current == "":
+		return g.cloneURL(repo)
+	case repoPath(current) == repoPath(repo.CloneURL) || repoPath(current) == repoPath(repo.SSHURL):
+		return current
+	case !strings.Contains(current, "://") && repo.SSHURL != "":
+		// scp like, e.g. git@github.com:gooflix/one.git
+		return repo.SSHURL
+	}
+	return repo.CloneURL
+}
+
+// repoPath returns the path of a clone url w/o its scheme, host and .git suffix, e.g. gooflix/one for both
+// https://github.com/gooflix/one.git and git@github.com:gooflix/one.git
+func repoPath(cloneURL string) string {
+	if i := strings.Index(cloneURL, "://"); i >= 0 {
+		cloneURL = cloneURL[i+3:]
+		if j := strings.Index(cloneURL, "/"); j >= 0 {
+			cloneURL = cloneURL[j:]
+		}
+	} else if i := strings.Index(cloneURL, ":"); i >= 0 {
+		cloneURL = cloneURL[i+1:]
+	}
+	return strings.TrimSuffix(strings.Trim(cloneURL, "/"), ".git")
+}
+
+// branch returns the branch the repo's config repo reads pipelines from: the repo's own (e.g. from its overrides),
+// the seeder's, or the repo's default branch, in that order
+func (g *GoCD) branch(repo *source.Repository) string {
+	if branch := source.BaseBranch(repo, g.Branch); branch != "" {
+		return branch
+	}
+	return DefaultBranch
+}
+
 // DeleteConfigRepo removes a config repo from GoCD
 func (g *GoCD) DeleteConfigRepo(repo *ConfigRepo, prefix string) (*http.Response, error) {
 	if prefix != "" {
@@ -230,9 +590,13 @@ func (g *GoCD) DeleteConfigRepo(repo *ConfigRepo, prefix string) (*http.Response
 		return resp, errors.Wrap(err, "error executing http request to delete a gocd config repo")
 	}
 	if resp.StatusCode > 399 {
-		return resp, errors.Wrap(fmt.Errorf(resp.Status), "invalid response status")
+		return resp, errors.Wrap(errors.New(resp.Status), "invalid response status")
 	}
 
+	g.filePatternsMu.Lock()
+	delete(g.filePatterns, repo.ID)
+	g.filePatternsMu.Unlock()
+
 	return resp, nil
 }
 
@@ -245,26 +609,77 @@ func (g *GoCD) DeleteConfigRepo(repo *ConfigRepo, prefix string) (*http.Response
 // New returns a GoCD Client
 func New(ctx context.Context, config map[string]string, hc *http.Client, logger log.Logger) ConfigRepoInterface {
 	return &GoCD{
-		URL:      config["GoCDURL"] + "/go/api/admin/config_repos",
-		User:     config["GoCDUser"],
-		Password: config["GoCDPassword"],
-		hc:       hc,
-		logger:   logger,
+		URL:           config["GoCDURL"] + "/go/api/admin/config_repos",
+		User:          config["GoCDUser"],
+		Password:      config["GoCDPassword"],
+		Branch:        config["GoCDBranch"],
+		CloneProtocol: config["GoCDCloneProtocol"],
+		encrypted:     map[string]string{},
+		filePatterns:  map[string]bool{},
+		hc:            hc,
+		logger:        logger,
 	}
 }
 
-// Reconcile ensures that repos that have been removed from Github, or are no longer found when
-// they had the topic to match removed, are also removed from GoCD
-func Reconcile(g ConfigRepoInterface, logger log.Logger, prefix string, gocdRepos []ConfigRepo, ghRepos []*github.Repository) error {
+// ConfigRepoID returns the id of the repo's config repo, i.e. the repo's name with the prefix, and the variant (e.g.
+// the branch) separated by "--" for the repo's additional config repos; a repo that already has a config repo of
+// another name keeps it
+func ConfigRepoID(repo *source.Repository, prefix string) string {
+	if repo.ConfigRepoID != "" {
+		return repo.ConfigRepoID
+	}
+	id := repo.Name
+	if prefix != "" {
+		id = prefix + "-" + id
+	}
+	if repo.Variant != "" {
+		id = id + "--" + repo.Variant
+	}
+	return id
+}
 
-	githubSeen := map[string]bool{}
-	for _, ghRepo := range ghRepos {
-		githubSeen[*ghRepo.Name] = true
+// hasAnyPrefix returns true if s starts with any of the prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Owned returns true if the config repo was created by the seeder using the given prefix
+func Owned(repo ConfigRepo, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	return strings.HasPrefix(repo.ID, prefix+"-")
+}
+
+// Reconcile ensures that repos that have been removed from their source (e.g. Github), or are no longer
+// found when they had the topic to match removed, are also removed from GoCD; only config repos owned by
+// the prefix are considered, so seeding several orgs into the same GoCD works; config repos are matched by id, as
+// repos can override their material's name; all config repos of the kept repos (e.g. skipped by policy) are kept,
+// including their variants
+func Reconcile(g ConfigRepoInterface, logger log.Logger, prefix string, gocdRepos []ConfigRepo, repos []*source.Repository, kept []*source.Repository) error {
+
+	seen := map[string]bool{}
+	for _, repo := range repos {
+		seen[ConfigRepoID(repo, prefix)] = true
+	}
+
+	var keptPrefixes []string
+	for _, repo := range kept {
+		id := ConfigRepoID(&source.Repository{Name: repo.Name, ConfigRepoID: repo.ConfigRepoID}, prefix)
+		seen[id] = true
+		keptPrefixes = append(keptPrefixes, id+"--")
 	}
 
 	for _, gocdRepo := range gocdRepos {
-		if githubSeen[gocdRepo.Material.Attributes.Name] != true ||
-			!githubSeen[gocdRepo.Material.Attributes.Name] {
+		if !Owned(gocdRepo, prefix) {
+			continue
+		}
+		if !seen[gocdRepo.ID] && !hasAnyPrefix(gocdRepo.ID, keptPrefixes) {
 			_, err := g.DeleteConfigRepo(&gocdRepo, prefix)
 			if err != nil {
 				return errors.Wrap(err, "error deleting config repo "+gocdRepo.ID)
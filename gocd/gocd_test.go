@@ -2,15 +2,17 @@ package gocd_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
 	"github.com/alex-leonhardt/gocd-seeder/gocd"
+	"github.com/alex-leonhardt/gocd-seeder/source"
 	"github.com/go-kit/kit/log"
-	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -151,10 +153,10 @@ func TestGetConfigRepoExists(t *testing.T) {
 		log.NewNopLogger(),
 	)
 
-	exampleGithubRepo := &github.Repository{
-		ID:       github.Int64(1234567890),
-		Name:     github.String("one"),
-		CloneURL: github.String(""),
+	exampleGithubRepo := &source.Repository{
+		ID:       "1234567890",
+		Name:     "one",
+		CloneURL: "",
 		Topics:   []string{"ci-gocd"},
 	}
 
@@ -183,9 +185,9 @@ func TestGetConfigRepoNotExists(t *testing.T) {
 		log.NewNopLogger(),
 	)
 
-	exampleGithubRepo := &github.Repository{
-		ID:   github.Int64(1234567890),
-		Name: github.String("null"),
+	exampleGithubRepo := &source.Repository{
+		ID:   "1234567890",
+		Name: "null",
 	}
 
 	configRepo, err := testGoCD.GetConfigRepo(exampleGithubRepo, "myprefix")
@@ -242,10 +244,10 @@ func TestCreateConfigRepo(t *testing.T) {
 		log.NewNopLogger(),
 	)
 
-	exampleGithubRepo := &github.Repository{
-		ID:       github.Int64(1234567890),
-		Name:     github.String("one"),
-		CloneURL: github.String("http://localhost/clone/repo/one"),
+	exampleGithubRepo := &source.Repository{
+		ID:       "1234567890",
+		Name:     "one",
+		CloneURL: "http://localhost/clone/repo/one",
 		Topics:   []string{"ci-gocd"},
 	}
 
@@ -255,6 +257,351 @@ func TestCreateConfigRepo(t *testing.T) {
 	assert.Equal(t, "myprefix-one", configRepo.ID)
 }
 
+func TestCreateConfigRepoOverrides(t *testing.T) {
+	ctx := context.Background()
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var posted gocd.ConfigRepo
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&posted))
+			assert.Equal(t, "json.config.plugin", posted.PluginID)
+			assert.Equal(t, "main", posted.Material.Attributes.Branch)
+			json.NewEncoder(w).Encode(posted)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(
+		ctx,
+		map[string]string{
+			"GoCDURL": hs.URL,
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+
+	exampleRepo := &source.Repository{
+		Name:     "vendored",
+		CloneURL: "https://git.vendor.example.com/vendored.git",
+		Branch:   "main",
+		PluginID: "json.config.plugin",
+	}
+
+	configRepo, err := testGoCD.CreateConfigRepo(exampleRepo, "manifest")
+	assert.Nil(t, err)
+	assert.Equal(t, "manifest-vendored", configRepo.ID)
+}
+
+func TestCreateConfigRepoMaterialOverrides(t *testing.T) {
+	ctx := context.Background()
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var posted struct {
+				gocd.ConfigRepo
+				Configuration []map[string]string `json:"configuration"`
+			}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&posted))
+			assert.Equal(t, "gooflix-myrepo", posted.ID)
+			assert.Equal(t, "pipelines", posted.Material.Attributes.Name)
+			assert.False(t, posted.Material.Attributes.AutoUpdate)
+			assert.Equal(t, []map[string]string{{"key": "file_pattern", "value": "ci/*.gocd.yaml"}}, posted.Configuration)
+			json.NewEncoder(w).Encode(posted.ConfigRepo)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(
+		ctx,
+		map[string]string{
+			"GoCDURL": hs.URL,
+		},
+		hs.Client(),
+		log.NewNopLogger(),
+	)
+
+	autoUpdate := false
+	exampleRepo := &source.Repository{
+		Name:         "myrepo",
+		CloneURL:     "https://github.com/gooflix/myrepo.git",
+		FilePattern:  "ci/*.gocd.yaml",
+		MaterialName: "pipelines",
+		AutoUpdate:   &autoUpdate,
+	}
+
+	_, err := testGoCD.CreateConfigRepo(exampleRepo, "gooflix")
+	assert.Nil(t, err)
+}
+
+func TestCreateConfigRepoBranch(t *testing.T) {
+	var createConfigRepoBranchTests = []struct {
+		name   string
+		config string
+		repo   *source.Repository
+		branch string
+	}{
+		{name: "default_branch", repo: &source.Repository{Name: "r", DefaultBranch: "main"}, branch: "main"},
+		{name: "no_default_branch", repo: &source.Repository{Name: "r"}, branch: "master"},
+		{name: "global", config: "develop", repo: &source.Repository{Name: "r", DefaultBranch: "main"}, branch: "develop"},
+		{name: "repo", config: "develop", repo: &source.Repository{Name: "r", DefaultBranch: "main", Branch: "release"}, branch: "release"},
+	}
+
+	for _, tt := range createConfigRepoBranchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var posted gocd.ConfigRepo
+					assert.Nil(t, json.NewDecoder(r.Body).Decode(&posted))
+					assert.Equal(t, tt.branch, posted.Material.Attributes.Branch)
+					json.NewEncoder(w).Encode(posted)
+				}))
+			defer hs.Close()
+
+			testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL, "GoCDBranch": tt.config}, hs.Client(), log.NewNopLogger())
+
+			_, err := testGoCD.CreateConfigRepo(tt.repo, "gooflix")
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestUpdateConfigRepo(t *testing.T) {
+	puts := 0
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPut, r.Method)
+			assert.Equal(t, "/go/api/admin/config_repos/gooflix-myrepo", r.URL.Path)
+			assert.Equal(t, `"abc"`, r.Header.Get("If-Match"))
+			puts++
+
+			var put gocd.ConfigRepo
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&put))
+			assert.Equal(t, "main", put.Material.Attributes.Branch)
+			assert.Equal(t, "myrepo", put.Material.Attributes.Name)
+
+			w.Header().Set("ETag", `"def"`)
+			json.NewEncoder(w).Encode(put)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL}, hs.Client(), log.NewNopLogger())
+
+	existing := gocd.ConfigRepo{ID: "gooflix-myrepo"}
+	existing.Material.Attributes.Name = "myrepo"
+	existing.Material.Attributes.Branch = "master"
+	existing.ETag = `"abc"`
+
+	repo := &source.Repository{Name: "myrepo", DefaultBranch: "main"}
+
+	updated, changed, err := testGoCD.UpdateConfigRepo(existing, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "main", updated.Material.Attributes.Branch)
+	assert.Equal(t, `"def"`, updated.ETag)
+
+	// up to date, nothing to put
+	_, changed, err = testGoCD.UpdateConfigRepo(updated, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 1, puts)
+}
+
+func TestUpdateConfigRepoRenamed(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the config repo keeps its id, and so GoCD its pipelines' history
+			assert.Equal(t, "/go/api/admin/config_repos/gooflix-one", r.URL.Path)
+
+			var put gocd.ConfigRepo
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&put))
+			json.NewEncoder(w).Encode(put)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL}, hs.Client(), log.NewNopLogger())
+
+	existing := gocd.ConfigRepo{ID: "gooflix-one"}
+	existing.Material.Attributes.Name = "one"
+	existing.Material.Attributes.URL = "https://github.com/gooflix/one.git"
+	existing.Material.Attributes.Branch = "master"
+
+	repo := &source.Repository{ID: "1", Name: "uno", CloneURL: "https://github.com/gooflix/uno.git", ConfigRepoID: "gooflix-one"}
+
+	updated, changed, err := testGoCD.UpdateConfigRepo(existing, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "uno", updated.Material.Attributes.Name)
+	assert.Equal(t, "https://github.com/gooflix/uno.git", updated.Material.Attributes.URL)
+	assert.Equal(t, "master", updated.Material.Attributes.Branch)
+}
+
+func TestUpdateConfigRepoURL(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var put gocd.ConfigRepo
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&put))
+			json.NewEncoder(w).Encode(put)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL}, hs.Client(), log.NewNopLogger())
+
+	one := &source.Repository{ID: "1", Name: "one", CloneURL: "https://github.com/gooflix/one.git", SSHURL: "git@github.com:gooflix/one.git", DefaultBranch: "master"}
+	transferred := &source.Repository{ID: "1", Name: "one", CloneURL: "https://github.com/acme/one.git", SSHURL: "git@github.com:acme/one.git", DefaultBranch: "master", ConfigRepoID: "gooflix-one"}
+
+	var urlTests = []struct {
+		name    string
+		current string
+		repo    *source.Repository
+		url     string
+		changed bool
+	}{
+		{
+			name:    "unchanged",
+			current: "https://github.com/gooflix/one.git",
+			repo:    one,
+			url:     "https://github.com/gooflix/one.git",
+		},
+		{
+			name:    "hand_edited",
+			current: "https://mirror.example.com/gooflix/one",
+			repo:    one,
+			url:     "https://mirror.example.com/gooflix/one",
+		},
+		{
+			name:    "hand_edited_ssh",
+			current: "ssh://git@github.com/gooflix/one.git",
+			repo:    one,
+			url:     "ssh://git@github.com/gooflix/one.git",
+		},
+		{
+			name:    "transferred",
+			current: "https://github.com/gooflix/one.git",
+			repo:    transferred,
+			url:     "https://github.com/acme/one.git",
+			changed: true,
+		},
+		{
+			name:    "transferred_ssh",
+			current: "git@github.com:gooflix/one.git",
+			repo:    transferred,
+			url:     "git@github.com:acme/one.git",
+			changed: true,
+		},
+		{
+			name:    "transferred_hand_edited",
+			current: "https://mirror.example.com/gooflix/one",
+			repo:    transferred,
+			url:     "https://github.com/acme/one.git",
+			changed: true,
+		},
+	}
+
+	for _, tt := range urlTests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := gocd.ConfigRepo{ID: "gooflix-one", PluginID: gocd.DefaultPluginID}
+			existing.Material.Attributes.Name = "one"
+			existing.Material.Attributes.URL = tt.current
+			existing.Material.Attributes.Branch = "master"
+			existing.Material.Attributes.AutoUpdate = true
+
+			updated, changed, err := testGoCD.UpdateConfigRepo(existing, tt.repo, "gooflix")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.changed, changed)
+			assert.Equal(t, tt.url, updated.Material.Attributes.URL)
+		})
+	}
+}
+
+func TestUpdateConfigRepoOverrides(t *testing.T) {
+	var put map[string]interface{}
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(body, &put))
+			w.Write(body)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL}, hs.Client(), log.NewNopLogger())
+
+	// as GoCD returns it, seeded before the repo had any overrides, with a property set by hand
+	var existing gocd.ConfigRepo
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"id": "gooflix-myrepo",
+		"plugin_id": "yaml.config.plugin",
+		"material": {"type": "git", "attributes": {"url": "https://github.com/gooflix/myrepo.git", "name": "myrepo", "branch": "main", "auto_update": true}},
+		"configuration": [{"key": "file_pattern", "value": "*.gocd.yaml"}, {"key": "other", "value": "x"}]
+	}`), &existing))
+
+	autoUpdate := false
+	repo := &source.Repository{
+		Name:          "myrepo",
+		CloneURL:      "https://github.com/gooflix/myrepo.git",
+		DefaultBranch: "main",
+		PluginID:      "json.config.plugin",
+		AutoUpdate:    &autoUpdate,
+		FilePattern:   "ci/*.json",
+	}
+
+	updated, changed, err := testGoCD.UpdateConfigRepo(existing, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "json.config.plugin", put["plugin_id"])
+	assert.Equal(t, false, put["material"].(map[string]interface{})["attributes"].(map[string]interface{})["auto_update"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "pipeline_pattern", "value": "ci/*.json"},
+		map[string]interface{}{"key": "other", "value": "x"},
+	}, put["configuration"])
+
+	// up to date, nothing to put
+	_, changed, err = testGoCD.UpdateConfigRepo(updated, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	// the overrides were removed from the repo again, the file pattern the seeder set goes with them
+	repo = &source.Repository{Name: "myrepo", CloneURL: "https://github.com/gooflix/myrepo.git", DefaultBranch: "main"}
+
+	_, changed, err = testGoCD.UpdateConfigRepo(updated, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "yaml.config.plugin", put["plugin_id"])
+	assert.Equal(t, true, put["material"].(map[string]interface{})["attributes"].(map[string]interface{})["auto_update"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "other", "value": "x"}}, put["configuration"])
+}
+
+func TestUpdateConfigRepoKeepsFilePattern(t *testing.T) {
+	var put map[string]interface{}
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(body, &put))
+			w.Write(body)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL}, hs.Client(), log.NewNopLogger())
+
+	// the file pattern was set by hand, the repo has no overrides
+	var existing gocd.ConfigRepo
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"id": "gooflix-myrepo",
+		"plugin_id": "yaml.config.plugin",
+		"material": {"type": "git", "attributes": {"url": "https://github.com/gooflix/myrepo.git", "name": "myrepo", "branch": "main", "auto_update": true}},
+		"configuration": [{"key": "file_pattern", "value": "ci/*.yaml"}]
+	}`), &existing))
+
+	// renamed, so it's updated
+	repo := &source.Repository{Name: "ourrepo", CloneURL: "https://github.com/gooflix/ourrepo.git", DefaultBranch: "main"}
+
+	updated, changed, err := testGoCD.UpdateConfigRepo(existing, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "ourrepo", put["material"].(map[string]interface{})["attributes"].(map[string]interface{})["name"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "file_pattern", "value": "ci/*.yaml"}}, put["configuration"])
+
+	// and it stays that way
+	_, changed, err = testGoCD.UpdateConfigRepo(updated, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+}
+
 func TestDeleteConfigRepoError400(t *testing.T) {
 	ctx := context.Background()
 	hs := httptest.NewServer(
@@ -344,3 +691,179 @@ func TestDeleteConfigRepoOK(t *testing.T) {
 	}
 	assert.Equal(t, 200, resp.StatusCode)
 }
+
+// FakeConfigRepos implements gocd.ConfigRepoInterface and records deleted config repos
+type FakeConfigRepos struct {
+	deleted []string
+}
+
+func (f *FakeConfigRepos) GetConfigRepos() ([]gocd.ConfigRepo, error) {
+	return nil, nil
+}
+
+func (f *FakeConfigRepos) UpdateConfigRepo(existing gocd.ConfigRepo, repo *source.Repository, prefix string) (gocd.ConfigRepo, bool, error) {
+	return existing, false, nil
+}
+
+func (f *FakeConfigRepos) GetConfigRepo(repo *source.Repository, prefix string) (gocd.ConfigRepo, error) {
+	return gocd.ConfigRepo{}, nil
+}
+
+func (f *FakeConfigRepos) CreateConfigRepo(repo *source.Repository, prefix string) (gocd.ConfigRepo, error) {
+	return gocd.ConfigRepo{}, nil
+}
+
+func (f *FakeConfigRepos) DeleteConfigRepo(repo *gocd.ConfigRepo, prefix string) (*http.Response, error) {
+	f.deleted = append(f.deleted, repo.ID)
+	return &http.Response{StatusCode: 200}, nil
+}
+
+func TestReconcileOnlyOwned(t *testing.T) {
+	configRepo := func(id, name string) gocd.ConfigRepo {
+		c := gocd.ConfigRepo{ID: id}
+		c.Material.Attributes.Name = name
+		return c
+	}
+
+	gocdRepos := []gocd.ConfigRepo{
+		configRepo("gooflix-one", "one"),
+		configRepo("gooflix-two", "two"),
+		configRepo("ac-three", "three"),
+		configRepo("handmade", "handmade"),
+	}
+
+	repos := []*source.Repository{
+		{Name: "one"},
+	}
+
+	fake := &FakeConfigRepos{}
+	err := gocd.Reconcile(fake, log.NewNopLogger(), "gooflix", gocdRepos, repos, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"gooflix-two"}, fake.deleted)
+}
+
+func TestReconcileVariants(t *testing.T) {
+	gocdRepos := []gocd.ConfigRepo{
+		{ID: "gooflix-one"},
+		{ID: "gooflix-one--release-1.x"},
+		{ID: "gooflix-one--release-2.x"},
+		{ID: "gooflix-skipped"},
+		{ID: "gooflix-skipped--release-1.x"},
+	}
+
+	repos := []*source.Repository{
+		{Name: "one"},
+		{Name: "one", Branch: "release/1.x", Variant: "release-1.x"},
+	}
+	kept := []*source.Repository{
+		{Name: "skipped"},
+	}
+
+	fake := &FakeConfigRepos{}
+	err := gocd.Reconcile(fake, log.NewNopLogger(), "gooflix", gocdRepos, repos, kept)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"gooflix-one--release-2.x"}, fake.deleted)
+}
+
+func TestReconcileTracked(t *testing.T) {
+	gocdRepos := []gocd.ConfigRepo{
+		{ID: "gooflix-one"},
+		{ID: "gooflix-two"},
+		{ID: "gooflix-two--release-1.x"},
+		{ID: "gooflix-uno"},
+	}
+
+	// one was renamed to uno, two was transferred and is kept for the org it moved to
+	repos := []*source.Repository{
+		{ID: "1", Name: "uno", ConfigRepoID: "gooflix-one"},
+	}
+	kept := []*source.Repository{
+		{ID: "2", ConfigRepoID: "gooflix-two"},
+	}
+
+	fake := &FakeConfigRepos{}
+	err := gocd.Reconcile(fake, log.NewNopLogger(), "gooflix", gocdRepos, repos, kept)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"gooflix-uno"}, fake.deleted)
+}
+
+func TestCreateConfigRepoSSH(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var posted gocd.ConfigRepo
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&posted))
+			json.NewEncoder(w).Encode(posted)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL, "GoCDCloneProtocol": gocd.ProtocolSSH}, hs.Client(), log.NewNopLogger())
+
+	configRepo, err := testGoCD.CreateConfigRepo(&source.Repository{Name: "one", CloneURL: "https://github.com/gooflix/one.git", SSHURL: "git@github.com:gooflix/one.git"}, "gooflix")
+	assert.Nil(t, err)
+	assert.Equal(t, "git@github.com:gooflix/one.git", configRepo.Material.Attributes.URL)
+
+	// manifest repos don't have an ssh url
+	configRepo, err = testGoCD.CreateConfigRepo(&source.Repository{Name: "vendored", CloneURL: "https://git.vendor.example.com/vendored.git"}, "manifest")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://git.vendor.example.com/vendored.git", configRepo.Material.Attributes.URL)
+}
+
+func TestCreateConfigRepoCredentials(t *testing.T) {
+	encrypts := 0
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/go/api/admin/encrypt":
+				encrypts++
+				var req map[string]string
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+				fmt.Fprintf(w, `{"encrypted_value": "AES:%d:%s"}`, encrypts, req["value"])
+			case "/go/api/admin/config_repos":
+				var posted gocd.ConfigRepo
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&posted))
+				json.NewEncoder(w).Encode(posted)
+			case "/go/api/admin/config_repos/gooflix-one":
+				var put gocd.ConfigRepo
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&put))
+				json.NewEncoder(w).Encode(put)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL}, hs.Client(), log.NewNopLogger())
+
+	repo := &source.Repository{Name: "one", CloneURL: "https://github.com/gooflix/one.git", Username: "x-access-token", Password: "t1"}
+
+	created, err := testGoCD.CreateConfigRepo(repo, "gooflix")
+	assert.Nil(t, err)
+	assert.Equal(t, "x-access-token", created.Material.Attributes.Username)
+	assert.Equal(t, "AES:1:t1", created.Material.Attributes.EncryptedPassword)
+
+	// the same token isn't encrypted again, so there's nothing to update
+	_, changed, err := testGoCD.UpdateConfigRepo(created, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 1, encrypts)
+
+	// a rotated token is
+	repo.Password = "t2"
+	updated, changed, err := testGoCD.UpdateConfigRepo(created, repo, "gooflix")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "AES:2:t2", updated.Material.Attributes.EncryptedPassword)
+}
+
+func TestEncryptError(t *testing.T) {
+	hs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+	defer hs.Close()
+
+	testGoCD := gocd.New(context.Background(), map[string]string{"GoCDURL": hs.URL}, hs.Client(), log.NewNopLogger())
+
+	_, err := testGoCD.CreateConfigRepo(&source.Repository{Name: "one", CloneURL: "https://github.com/gooflix/one.git", Username: "x-access-token", Password: "t1"}, "gooflix")
+	assert.NotNil(t, err)
+}
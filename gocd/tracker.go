@@ -0,0 +1,185 @@
+package gocd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/pkg/errors"
+)
+
+// Tracker records the config repo of each repo by the source's immutable id of the repo, so a repo that is renamed or
+// transferred keeps its config repo (and GoCD its pipelines' history); it is kept in Path, if set, to survive
+// restarts. A nil Tracker tracks nothing.
+type Tracker struct {
+	Path string
+	ids  map[string]string
+	mu   sync.Mutex
+}
+
+// TrackedRepo is a repo's config repo as it was tracked
+type TrackedRepo struct {
+	RepoID       string
+	ConfigRepoID string
+}
+
+// NewTracker returns a tracker that keeps its state in path, the state is read if the file exists
+func NewTracker(path string) (*Tracker, error) {
+
+	t := &Tracker{Path: path, ids: map[string]string{}}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read tracked config repos")
+	}
+
+	if err := json.Unmarshal(data, &t.ids); err != nil {
+		return nil, errors.Wrap(err, "unable to parse tracked config repos from "+path)
+	}
+
+	return t, nil
+}
+
+// Resolve sets the ConfigRepoID of each of the repos that is tracked
+func (t *Tracker) Resolve(repos []*source.Repository) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, repo := range repos {
+		if id, ok := t.ids[trackingKey(repo)]; ok {
+			repo.ConfigRepoID = id
+		}
+	}
+}
+
+// Track records the repo's config repo
+func (t *Tracker) Track(repo *source.Repository, configRepoID string) error {
+	if t == nil || repo.ID == "" {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := trackingKey(repo)
+	if t.ids[key] == configRepoID {
+		return nil
+	}
+	t.ids[key] = configRepoID
+
+	return t.save()
+}
+
+// Missing returns the tracked repos (w/o their variants) whose config repo is owned by the prefix but which are not
+// among the repos, e.g. as they were deleted or transferred
+func (t *Tracker) Missing(prefix string, repos []*source.Repository) []TrackedRepo {
+	if t == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, repo := range repos {
+		seen[repo.ID] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var missing []TrackedRepo
+	for key, id := range t.ids {
+		repoID, variant := splitTrackingKey(key)
+		if variant != "" || seen[repoID] || !Owned(ConfigRepo{ID: id}, prefix) {
+			continue
+		}
+		missing = append(missing, TrackedRepo{RepoID: repoID, ConfigRepoID: id})
+	}
+
+	return missing
+}
+
+// Prune forgets the repos whose config repo is not one of the config repos any more
+func (t *Tracker) Prune(configRepos []ConfigRepo) error {
+	if t == nil {
+		return nil
+	}
+
+	exists := map[string]bool{}
+	for _, configRepo := range configRepos {
+		exists[configRepo.ID] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pruned := false
+	for key, id := range t.ids {
+		if !exists[id] {
+			delete(t.ids, key)
+			pruned = true
+		}
+	}
+
+	if !pruned {
+		return nil
+	}
+	return t.save()
+}
+
+// save writes the state to Path, through a temporary file so a crash doesn't leave half of it
+func (t *Tracker) save() error {
+
+	if t.Path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(t.ids, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshalling tracked config repos")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(t.Path), filepath.Base(t.Path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "unable to save tracked config repos")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "unable to save tracked config repos")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "unable to save tracked config repos")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), t.Path), "unable to save tracked config repos")
+}
+
+// trackingKey is the repo's id, and its variant if it has one
+func trackingKey(repo *source.Repository) string {
+	if repo.Variant == "" {
+		return repo.ID
+	}
+	return repo.ID + "/" + repo.Variant
+}
+
+// splitTrackingKey splits a trackingKey into the repo's id and variant
+func splitTrackingKey(key string) (string, string) {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
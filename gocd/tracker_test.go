@@ -0,0 +1,73 @@
+package gocd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/gocd"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tracking.json")
+	tracker, err := gocd.NewTracker(path)
+	assert.Nil(t, err)
+
+	one := &source.Repository{ID: "1", Name: "one"}
+	release := &source.Repository{ID: "1", Name: "one", Variant: "release-1.x"}
+	assert.Nil(t, tracker.Track(one, "gooflix-one"))
+	assert.Nil(t, tracker.Track(release, "gooflix-one--release-1.x"))
+
+	// the repo was renamed, and the seeder restarted
+	tracker, err = gocd.NewTracker(path)
+	assert.Nil(t, err)
+
+	uno := &source.Repository{ID: "1", Name: "uno"}
+	unoRelease := &source.Repository{ID: "1", Name: "uno", Variant: "release-1.x"}
+	other := &source.Repository{ID: "2", Name: "two"}
+	tracker.Resolve([]*source.Repository{uno, unoRelease, other})
+	assert.Equal(t, "gooflix-one", gocd.ConfigRepoID(uno, "gooflix"))
+	assert.Equal(t, "gooflix-one--release-1.x", gocd.ConfigRepoID(unoRelease, "gooflix"))
+	assert.Equal(t, "gooflix-two", gocd.ConfigRepoID(other, "gooflix"))
+
+	// missing from the org's repos, e.g. transferred
+	assert.Equal(t, []gocd.TrackedRepo{{RepoID: "1", ConfigRepoID: "gooflix-one"}}, tracker.Missing("gooflix", []*source.Repository{other}))
+	assert.Len(t, tracker.Missing("gooflix", []*source.Repository{uno}), 0)
+	assert.Len(t, tracker.Missing("ac", []*source.Repository{other}), 0)
+
+	// config repos that are gone are forgotten
+	assert.Nil(t, tracker.Prune([]gocd.ConfigRepo{{ID: "gooflix-one"}}))
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "release-1.x")
+}
+
+func TestTrackerNil(t *testing.T) {
+	var tracker *gocd.Tracker
+
+	repo := &source.Repository{ID: "1", Name: "one"}
+	assert.Nil(t, tracker.Track(repo, "gooflix-one"))
+	tracker.Resolve([]*source.Repository{repo})
+	assert.Equal(t, "", repo.ConfigRepoID)
+	assert.Len(t, tracker.Missing("gooflix", nil), 0)
+	assert.Nil(t, tracker.Prune(nil))
+}
+
+func TestNewTrackerInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tracking.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("{"), 0600))
+
+	_, err = gocd.NewTracker(path)
+	assert.NotNil(t, err)
+}
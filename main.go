@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"expvar"
 	"fmt"
 	"io/ioutil"
@@ -10,11 +11,18 @@ import (
 	"os/signal"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/alex-leonhardt/gocd-seeder/bitbucket"
+	"github.com/alex-leonhardt/gocd-seeder/deploykey"
 	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/alex-leonhardt/gocd-seeder/gitea"
+	"github.com/alex-leonhardt/gocd-seeder/gitlab"
 	"github.com/alex-leonhardt/gocd-seeder/gocd"
+	"github.com/alex-leonhardt/gocd-seeder/manifest"
+	"github.com/alex-leonhardt/gocd-seeder/source"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
@@ -43,17 +51,65 @@ func help() {
 	fmt.Printf(
 		`Set the following environment vars: 
 
-Required:
+Required (Github, GitLab, Bitbucket, Gitea and/or a manifest):
 =========
 GITHUB_API_KEY  (e.g.: 1235436, use GITHUB_SECRETS_PATH when deploying to kubernetes)
-GITHUB_ORG      (e.g.: gooflix)
+  or, to authenticate as a Github App installation:
+GITHUB_APP_ID              (e.g.: 12345)
+GITHUB_APP_INSTALLATION_ID (e.g.: 6789012)
+GITHUB_APP_PRIVATE_KEY     (the app's PEM encoded private key, use GITHUB_SECRETS_PATH when deploying to kubernetes)
+GITHUB_ORG      (e.g.: gooflix, or a list of orgs with an optional config repo ID prefix each: gooflix,acme:ac)
+
+GITLAB_TOKEN    (a private token with read_api scope, use GITLAB_SECRETS_PATH when deploying to kubernetes)
+GITLAB_GROUPS   (e.g.: platform, or a list of groups with an optional config repo ID prefix each: platform,tools/ci:ci)
+
+BITBUCKET_URL      (e.g.: https://bitbucket.example.com)
+BITBUCKET_TOKEN    (an http access token with project read permission, use BITBUCKET_SECRETS_PATH when deploying to kubernetes)
+BITBUCKET_PROJECTS (e.g.: LEG, or a list of project keys with an optional config repo ID prefix each: LEG:legacy,OPS)
+
+GITEA_URL       (e.g.: https://forgejo.example.com)
+GITEA_TOKEN     (an access token with read:organization and read:repository scope, use GITEA_SECRETS_PATH when deploying to kubernetes)
+GITEA_ORGS      (e.g.: edge, or a list of orgs with an optional config repo ID prefix each: edge:ed,infra)
+
+MANIFEST_PATH   (e.g.: /etc/gocd-seeder/manifest.yaml, a YAML or JSON file listing repos to seed)
 
 Optional:
 =========
-GITHUB_TOPIC    (default: ci-gocd)
+GITHUB_BASE_URL   (e.g.: https://github.example.com, for Github Enterprise Server)
+GITHUB_UPLOAD_URL (default: <GITHUB_BASE_URL>/api/uploads/)
+GITHUB_CA_BUNDLE  (e.g.: /etc/ssl/internal-ca.pem, trusted in addition to the system's CAs)
+GITHUB_TOPIC    (default: ci-gocd, or an expression, e.g.: ci-gocd AND NOT deprecated)
+GITHUB_PER_PAGE (default: 100, max: 100)
+GITHUB_DISCOVERY (default: list, available: list, search, graphql)
+GITHUB_INCLUDE  (e.g.: svc-*,/^gooflix\/api-.*$/)
+GITHUB_EXCLUDE  (e.g.: *-playground,tmp-*)
+GITHUB_TEAMS    (e.g.: platform,infra, only seed repos these teams have access to)
+GITHUB_CONFIG_FILE_PATTERN (default: *.gocd.yaml)
+GITHUB_REPO_POLICY (e.g.: archived:remove,disabled:remove,fork:skip,template:skip,empty:skip)
+GITHUB_RATE_LIMIT_RESERVE (default: 100, discovery waits for the rate limit to reset when fewer requests are left)
+GITHUB_WEBHOOK_SECRET (e.g.: s3cr3t, receive repository webhooks on the stats port, use GITHUB_SECRETS_PATH when deploying to kubernetes)
+GITHUB_WEBHOOK_PATH   (default: /webhooks/github)
+GITHUB_PR_TOPIC       (e.g.: ci-gocd-pr)
+GITHUB_DEPLOY_KEY_SINK (e.g.: /var/lib/gocd-seeder/keys, or https://keys.example.com/gocd)
+GITHUB_MATERIAL_CREDENTIALS (default: none, or seeder, token)
+GITHUB_MATERIAL_TOKEN (e.g.: a bot's token, use GITHUB_SECRETS_PATH when deploying to kubernetes)
+GITHUB_TRACKING_PATH  (e.g.: /var/lib/gocd-seeder/tracking.json, remembers renamed and transferred repos across restarts)
+GITLAB_URL      (default: https://gitlab.com)
+GITLAB_TOPIC    (default: ci-gocd)
+GITLAB_CONFIG_FILE_PATTERN (default: *.gocd.yaml)
+BITBUCKET_DISCOVERY   (default: label, available: label, file)
+BITBUCKET_LABEL       (default: ci-gocd)
+BITBUCKET_MARKER_FILE (default: .gocd)
+BITBUCKET_CONFIG_FILE_PATTERN (default: *.gocd.yaml)
+GITEA_TOPIC     (default: ci-gocd)
+GITEA_CONFIG_FILE_PATTERN (default: *.gocd.yaml)
+MANIFEST_PREFIX (default: manifest)
 GOCD_URL        (default: http://localhost:8081)
 GOCD_USER       (e.g.: admin, use GOCD_SECRETS_PATH when deploying to kubernetes)
 GOCD_PASSWORD   (e.g.: admin, use GOCD_SECRETS_PATH when deploying to kubernetes)
+GOCD_BRANCH     (default: each repo's default branch)
+GOCD_BRANCHES   (e.g.: release/*,hotfix/*)
+GOCD_CLONE_PROTOCOL (default: https, or ssh)
 HTTP_STATS_IP   (default: "")
 HTTP_STATS_PORT (default: 9090)
 LOG_LEVEL       (e.g.: DEBUG)
@@ -65,6 +121,18 @@ Optional, howver, recommended to use as env vars can be seen in clear in the das
 
 GITHUB_SECRETS_PATH (e.g: /secrets/github)
 -- if set, must contain a file "api_key" with the github api key
+-- if set and GITHUB_APP_ID is set, must contain a file "app_private_key" with the github app's private key instead
+-- if set, may contain a file "webhook_secret" with the github webhook secret
+-- if set, may contain a file "material_token" with the token GoCD clones github repos with
+
+GITLAB_SECRETS_PATH (e.g: /secrets/gitlab)
+-- if set, must contain a file "token" with the gitlab private token
+
+BITBUCKET_SECRETS_PATH (e.g: /secrets/bitbucket)
+-- if set, must contain a file "token" with the bitbucket http access token
+
+GITEA_SECRETS_PATH (e.g: /secrets/gitea)
+-- if set, must contain a file "token" with the gitea access token
 
 GOCD_SECRETS_PATH (e.g.: /secrets/gocd)
 -- if set, must contain a file "gocd_password" with the password corresponding to the gocd_user
@@ -106,6 +174,262 @@ func ReadSecretFromFile(reader ConfigReader) (string, error) {
 
 // ------------------------------------------------
 
+// seedSource is a source of repos for a single org (group, ...), its config repos are namespaced by prefix and
+// created through gocd; the tracker, if any, remembers the config repos of renamed and transferred repos
+type seedSource struct {
+	name    string
+	prefix  string
+	source  source.Source
+	gocd    gocd.ConfigRepoInterface
+	tracker *gocd.Tracker
+}
+
+// seedRepo creates the repo's config repo, unless it exists already, then it is updated if the repo's name, branch,
+// overrides or credentials changed; branch is the seeder's (GOCD_BRANCH)
+func seedRepo(logger log.Logger, seed seedSource, repo *source.Repository, branch string) {
+
+	// credentials are asked for every time, tokens are rotated
+	if c, ok := seed.source.(source.Credentialer); ok {
+		var err error
+		repo.Username, repo.Password, err = c.Credentials(repo)
+		if err != nil {
+			level.Error(logger).Log("msg", errors.Wrap(err, "error retrieving credentials for "+repo.FullName))
+			return
+		}
+	}
+
+	existing, err := seed.gocd.GetConfigRepo(repo, seed.prefix)
+	if err == nil {
+		updated, changed, err := seed.gocd.UpdateConfigRepo(existing, repo, seed.prefix)
+		if err != nil {
+			level.Error(logger).Log("msg", errors.Wrap(err, "error updating config repo for "+repo.FullName))
+			return
+		}
+		if changed {
+			level.Info(logger).Log("msg", fmt.Sprintf("updated %s, reading branch %s of %s", updated.ID, updated.Material.Attributes.Branch, updated.Material.Attributes.URL))
+		}
+		track(logger, seed, repo, existing.ID)
+		return
+	}
+
+	if err.Error() != "404 Not Found" {
+		level.Warn(logger).Log("msg", errors.Wrap(err, "error retrieving gocd config repo for "+repo.FullName))
+		return
+	}
+
+	// gocd would fail to parse a config repo w/o any pipeline config in it, forever; the config file must be on the
+	// branch the config repo reads, which may be the seeder's
+	checked := *repo
+	checked.Branch = source.BaseBranch(repo, branch)
+	configured, err := seed.source.HasConfigFile(&checked)
+	if err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error checking for config file in "+repo.FullName))
+		return
+	}
+	if !configured {
+		level.Warn(logger).Log("msg", "tagged but unconfigured, no config file found in "+repo.FullName)
+		return
+	}
+
+	newRepoConfig, err := seed.gocd.CreateConfigRepo(repo, seed.prefix)
+	if err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error creating config repo for "+repo.FullName))
+		return
+	}
+
+	level.Info(logger).Log("msg", "created "+newRepoConfig.ID)
+	track(logger, seed, repo, gocd.ConfigRepoID(repo, seed.prefix))
+}
+
+// track records the repo's config repo, so it is kept when the repo is renamed or transferred
+func track(logger log.Logger, seed seedSource, repo *source.Repository, id string) {
+	if err := seed.tracker.Track(repo, id); err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error tracking config repo "+id))
+	}
+}
+
+// movedRepos returns the seed's tracked repos, missing from the repos, that were transferred to another of the seeded
+// owners; their config repos are kept, the owner they moved to seeds them now
+func movedRepos(logger log.Logger, seed seedSource, repos []*source.Repository) []*source.Repository {
+
+	mover, ok := seed.source.(source.Mover)
+	if !ok {
+		return nil
+	}
+
+	var moved []*source.Repository
+	for _, tracked := range seed.tracker.Missing(seed.prefix, repos) {
+		ok, err := mover.Moved(tracked.RepoID)
+		if err != nil {
+			// it's kept until we know better
+			level.Error(logger).Log("msg", errors.Wrap(err, "error checking whether the repo of "+tracked.ConfigRepoID+" was transferred"))
+		}
+		if ok || err != nil {
+			moved = append(moved, &source.Repository{ID: tracked.RepoID, ConfigRepoID: tracked.ConfigRepoID})
+		}
+	}
+
+	return moved
+}
+
+// expandRepos applies the repos' overrides and adds the config repos of their long-lived branches and pull requests,
+// branch is the seeder's (GOCD_BRANCH); it returns the expanded repos, and the repos that could not be expanded,
+// whose config repos are to be kept
+func expandRepos(logger log.Logger, seed seedSource, repos []*source.Repository, branch string, branchPatterns []string, pullRequestTopic string) ([]*source.Repository, []*source.Repository) {
+
+	var kept []*source.Repository
+
+	repos, failed, errs := source.ApplyOverrides(seed.source, repos)
+	kept = append(kept, failed...)
+	for _, err := range errs {
+		level.Error(logger).Log("msg", err)
+	}
+
+	repos, failed, errs = source.ExpandBranches(seed.source, repos, branchPatterns, branch)
+	kept = append(kept, failed...)
+	for _, err := range errs {
+		level.Error(logger).Log("msg", err)
+	}
+
+	repos, failed, errs = source.ExpandPullRequests(seed.source, repos, pullRequestTopic, branch)
+	kept = append(kept, failed...)
+	for _, err := range errs {
+		level.Error(logger).Log("msg", err)
+	}
+
+	return repos, kept
+}
+
+// removeRepo removes the repo's config repo, if there is one
+func removeRepo(logger log.Logger, seed seedSource, repo *source.Repository) {
+
+	configRepo, err := seed.gocd.GetConfigRepo(repo, seed.prefix)
+	if err != nil {
+		if err.Error() != "404 Not Found" {
+			level.Warn(logger).Log("msg", errors.Wrap(err, "error retrieving gocd config repo for "+repo.FullName))
+		}
+		return
+	}
+
+	if _, err := seed.gocd.DeleteConfigRepo(&configRepo, seed.prefix); err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error deleting config repo "+configRepo.ID))
+		return
+	}
+
+	level.Info(logger).Log("msg", fmt.Sprintf("removed gocd config repo %s for %s", configRepo.ID, repo.FullName))
+}
+
+// seedCycle seeds the repos of the seed, then removes the config repos of the repos that are gone; it returns the
+// number of repos found
+func seedCycle(logger log.Logger, seed seedSource, branch string, branchPatterns []string, pullRequestTopic string) int {
+
+	// keep pulling repos and add them as they are created ...
+	foundRepos, skippedRepos, err := seed.source.Repos()
+
+	if err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error retrieving repos of "+seed.name))
+	}
+
+	if foundRepos == nil {
+		return 0
+	}
+
+	// a repo that cannot be expanded is reported and left as it is, like a skipped one
+	var keptRepos []*source.Repository
+	foundRepos, keptRepos = expandRepos(logger, seed, foundRepos, branch, branchPatterns, pullRequestTopic)
+	skippedRepos = append(skippedRepos, keptRepos...)
+
+	seed.tracker.Resolve(foundRepos)
+	seed.tracker.Resolve(skippedRepos)
+
+	for _, repo := range foundRepos {
+		seedRepo(logger, seed, repo, branch)
+	}
+
+	// -------------------------------------
+
+	// get all gocd config repos
+	foundGoCDConfigRepos, err := seed.gocd.GetConfigRepos()
+	if err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error retrieving all config repos from gocd"))
+	} else if err := seed.tracker.Prune(foundGoCDConfigRepos); err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error pruning tracked config repos"))
+	}
+
+	// repos transferred to another org keep their config repo
+	known := append(append([]*source.Repository{}, foundRepos...), skippedRepos...)
+	skippedRepos = append(skippedRepos, movedRepos(logger, seed, known)...)
+
+	// repos skipped by policy are not seeded, but their existing config repos are kept
+	err = gocd.Reconcile(seed.gocd, logger, seed.prefix, foundGoCDConfigRepos, foundRepos, skippedRepos)
+	if err != nil {
+		level.Error(logger).Log("msg", errors.Wrap(err, "error reconciling gocd config repos with repos of "+seed.name))
+	}
+
+	return len(foundRepos)
+}
+
+// applyChanges returns the func webhooks apply their changes with, seeding or removing each changed repo through the
+// seed of its org; it holds seeding while it does, like polling does
+func applyChanges(logger log.Logger, seeding *sync.Mutex, seeds map[string]seedSource, branch string, branchPatterns []string, pullRequestTopic string) func([]gh.Change) {
+	return func(changes []gh.Change) {
+		seeding.Lock()
+		defer seeding.Unlock()
+
+		for _, change := range changes {
+			seed, ok := seeds[change.Org]
+			if !ok {
+				continue
+			}
+			repo := gh.ToRepository(change.Repo)
+			repo.Team = change.Team
+
+			switch change.Action {
+			case gh.PolicySeed:
+				repos, _ := expandRepos(logger, seed, []*source.Repository{repo}, branch, branchPatterns, pullRequestTopic)
+				seed.tracker.Resolve(repos)
+				for _, repo := range repos {
+					seedRepo(logger, seed, repo, branch)
+				}
+			case gh.PolicyRemove:
+				// a tracked config repo moves along with its repo, it's updated when the repo is seeded under its new
+				// name or owner, or removed by polling if it isn't
+				seed.tracker.Resolve([]*source.Repository{repo})
+				if change.Moved && repo.ConfigRepoID != "" {
+					continue
+				}
+				removeRepo(logger, seed, repo)
+			}
+		}
+	}
+}
+
+// throttled returns how long the seed's source is rate limited for, 0 if it isn't
+func throttled(seed seedSource) time.Duration {
+	if t, ok := seed.source.(source.Throttled); ok {
+		return t.Delay()
+	}
+	return 0
+}
+
+// nextCycle returns how long to wait until the first seed can be asked for repos again, when all of them are rate
+// limited, else 0
+func nextCycle(seeds []seedSource) time.Duration {
+	var next time.Duration
+	for _, seed := range seeds {
+		delay := throttled(seed)
+		if delay == 0 {
+			return 0
+		}
+		if next == 0 || delay < next {
+			next = delay
+		}
+	}
+	return next
+}
+
+// ------------------------------------------------
+
 // Goroutines provide goroutines stats for expvar
 func Goroutines() interface{} {
 	return runtime.NumGoroutine()
@@ -133,15 +457,70 @@ func main() {
 	// ------------------------------------------------
 
 	githubConfig := map[string]string{
-		"GithubAPIKey":     Getenv("GITHUB_API_KEY", ""),
-		"GithubOrgMatch":   Getenv("GITHUB_ORG", "ORG_DOES_NOT_EXIST_MUST_SET_VALUE_FROM_ENV"),
-		"GithubTopicMatch": Getenv("GITHUB_TOPIC", "ci-gocd"),
+		"GithubAPIKey":              Getenv("GITHUB_API_KEY", ""),
+		"GithubAppID":               Getenv("GITHUB_APP_ID", ""),
+		"GithubAppInstallationID":   Getenv("GITHUB_APP_INSTALLATION_ID", ""),
+		"GithubAppPrivateKey":       Getenv("GITHUB_APP_PRIVATE_KEY", ""),
+		"GithubBaseURL":             Getenv("GITHUB_BASE_URL", ""),
+		"GithubUploadURL":           Getenv("GITHUB_UPLOAD_URL", ""),
+		"GithubCABundle":            Getenv("GITHUB_CA_BUNDLE", ""),
+		"GithubOrgMatch":            Getenv("GITHUB_ORG", "ORG_DOES_NOT_EXIST_MUST_SET_VALUE_FROM_ENV"),
+		"GithubTopicMatch":          Getenv("GITHUB_TOPIC", "ci-gocd"),
+		"GithubPerPage":             Getenv("GITHUB_PER_PAGE", "100"),
+		"GithubDiscovery":           Getenv("GITHUB_DISCOVERY", "list"),
+		"GithubInclude":             Getenv("GITHUB_INCLUDE", ""),
+		"GithubExclude":             Getenv("GITHUB_EXCLUDE", ""),
+		"GithubRepoPolicy":          Getenv("GITHUB_REPO_POLICY", ""),
+		"GithubConfigFilePattern":   Getenv("GITHUB_CONFIG_FILE_PATTERN", "*.gocd.yaml"),
+		"GithubRateLimitReserve":    Getenv("GITHUB_RATE_LIMIT_RESERVE", "100"),
+		"GithubTeams":               Getenv("GITHUB_TEAMS", ""),
+		"GithubWebhookSecret":       Getenv("GITHUB_WEBHOOK_SECRET", ""),
+		"GithubWebhookPath":         Getenv("GITHUB_WEBHOOK_PATH", "/webhooks/github"),
+		"GithubPullRequestTopic":    Getenv("GITHUB_PR_TOPIC", ""),
+		"GithubDeployKeySink":       Getenv("GITHUB_DEPLOY_KEY_SINK", ""),
+		"GithubMaterialCredentials": Getenv("GITHUB_MATERIAL_CREDENTIALS", "none"),
+		"GithubMaterialToken":       Getenv("GITHUB_MATERIAL_TOKEN", ""),
+		"GithubTrackingPath":        Getenv("GITHUB_TRACKING_PATH", ""),
 	}
 
 	gocdConfig := map[string]string{
-		"GoCDURL":      Getenv("GOCD_URL", "http://localhost:8081"),
-		"GoCDUser":     Getenv("GOCD_USER", ""),
-		"GoCDPassword": Getenv("GOCD_PASSWORD", ""),
+		"GoCDURL":           Getenv("GOCD_URL", "http://localhost:8081"),
+		"GoCDUser":          Getenv("GOCD_USER", ""),
+		"GoCDPassword":      Getenv("GOCD_PASSWORD", ""),
+		"GoCDBranch":        Getenv("GOCD_BRANCH", ""),
+		"GoCDBranches":      Getenv("GOCD_BRANCHES", ""),
+		"GoCDCloneProtocol": Getenv("GOCD_CLONE_PROTOCOL", gocd.ProtocolHTTPS),
+	}
+
+	gitlabConfig := map[string]string{
+		"GitLabURL":               Getenv("GITLAB_URL", "https://gitlab.com"),
+		"GitLabToken":             Getenv("GITLAB_TOKEN", ""),
+		"GitLabGroups":            Getenv("GITLAB_GROUPS", ""),
+		"GitLabTopicMatch":        Getenv("GITLAB_TOPIC", "ci-gocd"),
+		"GitLabConfigFilePattern": Getenv("GITLAB_CONFIG_FILE_PATTERN", "*.gocd.yaml"),
+	}
+
+	bitbucketConfig := map[string]string{
+		"BitbucketURL":               Getenv("BITBUCKET_URL", ""),
+		"BitbucketToken":             Getenv("BITBUCKET_TOKEN", ""),
+		"BitbucketProjects":          Getenv("BITBUCKET_PROJECTS", ""),
+		"BitbucketDiscovery":         Getenv("BITBUCKET_DISCOVERY", "label"),
+		"BitbucketLabel":             Getenv("BITBUCKET_LABEL", "ci-gocd"),
+		"BitbucketMarkerFile":        Getenv("BITBUCKET_MARKER_FILE", ".gocd"),
+		"BitbucketConfigFilePattern": Getenv("BITBUCKET_CONFIG_FILE_PATTERN", "*.gocd.yaml"),
+	}
+
+	giteaConfig := map[string]string{
+		"GiteaURL":               Getenv("GITEA_URL", ""),
+		"GiteaToken":             Getenv("GITEA_TOKEN", ""),
+		"GiteaOrgs":              Getenv("GITEA_ORGS", ""),
+		"GiteaTopicMatch":        Getenv("GITEA_TOPIC", "ci-gocd"),
+		"GiteaConfigFilePattern": Getenv("GITEA_CONFIG_FILE_PATTERN", "*.gocd.yaml"),
+	}
+
+	manifestConfig := map[string]string{
+		"ManifestPath":   Getenv("MANIFEST_PATH", ""),
+		"ManifestPrefix": Getenv("MANIFEST_PREFIX", "manifest"),
 	}
 
 	httpConfig := map[string]string{
@@ -151,6 +530,9 @@ func main() {
 
 	githubSecretsPath := Getenv("GITHUB_SECRETS_PATH", "")
 	gocdSecretsPath := Getenv("GOCD_SECRETS_PATH", "")
+	gitlabSecretsPath := Getenv("GITLAB_SECRETS_PATH", "")
+	bitbucketSecretsPath := Getenv("BITBUCKET_SECRETS_PATH", "")
+	giteaSecretsPath := Getenv("GITEA_SECRETS_PATH", "")
 
 	// ------------------------------------------------
 
@@ -164,7 +546,7 @@ func main() {
 		logger = level.NewFilter(logger, level.AllowInfo())
 	}
 
-	if githubSecretsPath != "" {
+	if githubSecretsPath != "" && githubConfig["GithubAppID"] == "" {
 		var value string
 		var err error
 		reader := ConfigFileReader{
@@ -179,6 +561,87 @@ func main() {
 		}
 	}
 
+	if githubSecretsPath != "" && githubConfig["GithubAppID"] != "" {
+		var value string
+		var err error
+		reader := ConfigFileReader{
+			path: githubSecretsPath + "/app_private_key",
+		}
+		// read the github app's private key and set to GithubAppPrivateKey in githubConfig map
+		value, err = ReadSecretFromFile(reader)
+		githubConfig["GithubAppPrivateKey"] = value
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
+	}
+
+	// the material token is optional, it's only needed for GITHUB_MATERIAL_CREDENTIALS=token; it's read whenever
+	// it's needed, so it can be rotated w/o a restart
+	if _, err := os.Stat(githubSecretsPath + "/material_token"); githubSecretsPath != "" && err == nil {
+		githubConfig["GithubMaterialTokenPath"] = githubSecretsPath + "/material_token"
+	}
+
+	// the webhook secret is optional, webhooks are only received when it's set
+	if _, err := os.Stat(githubSecretsPath + "/webhook_secret"); githubSecretsPath != "" && err == nil {
+		var value string
+		reader := ConfigFileReader{
+			path: githubSecretsPath + "/webhook_secret",
+		}
+		// read config file and set to GithubWebhookSecret in githubConfig map
+		value, err = ReadSecretFromFile(reader)
+		githubConfig["GithubWebhookSecret"] = value
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
+	}
+
+	if gitlabSecretsPath != "" {
+		var value string
+		var err error
+		reader := ConfigFileReader{
+			path: gitlabSecretsPath + "/token",
+		}
+		// read config file and set to GitLabToken in gitlabConfig map
+		value, err = ReadSecretFromFile(reader)
+		gitlabConfig["GitLabToken"] = value
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
+	}
+
+	if bitbucketSecretsPath != "" {
+		var value string
+		var err error
+		reader := ConfigFileReader{
+			path: bitbucketSecretsPath + "/token",
+		}
+		// read config file and set to BitbucketToken in bitbucketConfig map
+		value, err = ReadSecretFromFile(reader)
+		bitbucketConfig["BitbucketToken"] = value
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
+	}
+
+	if giteaSecretsPath != "" {
+		var value string
+		var err error
+		reader := ConfigFileReader{
+			path: giteaSecretsPath + "/token",
+		}
+		// read config file and set to GiteaToken in giteaConfig map
+		value, err = ReadSecretFromFile(reader)
+		giteaConfig["GiteaToken"] = value
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
+	}
+
 	if gocdSecretsPath != "" {
 		var value string
 		var err error
@@ -210,94 +673,248 @@ func main() {
 		Timeout: 10 * time.Second,
 	}
 
-	myGithub, err := gh.New(nil, githubConfig, logger, nil)
-	if err != nil {
+	// cancelled on shutdown, so we stop paging through repos partway through
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var seeds []seedSource
+
+	if protocol := gocdConfig["GoCDCloneProtocol"]; protocol != gocd.ProtocolHTTPS && protocol != gocd.ProtocolSSH {
+		err := fmt.Errorf("invalid clone protocol %q, must be %s or %s", protocol, gocd.ProtocolHTTPS, gocd.ProtocolSSH)
 		level.Error(logger).Log("msg", err)
+		panic(err)
 	}
 
 	myGoCD := gocd.New(nil, gocdConfig, defaultHTTPClient, logger)
 
-	doneChan := make(chan bool)
-	ticker := time.NewTicker(55 * time.Second)
+	branchPatterns, err := source.ParseBranchPatterns(gocdConfig["GoCDBranches"])
+	if err != nil {
+		level.Error(logger).Log("msg", err)
+		panic(err)
+	}
 
-	// ------------------------------------------------
+	// polling and webhooks must not seed (or reconcile) the same config repos at the same time
+	var seeding sync.Mutex
 
-	expvar.Publish("Uptime", expvar.Func(Uptime))
-	expvar.Publish("Goroutines", expvar.Func(Goroutines))
+	// github is seeded when credentials were set
+	if githubConfig["GithubAPIKey"] != "" || githubConfig["GithubAppID"] != "" {
 
-	go func() {
-		level.Info(logger).Log("msg", http.ListenAndServe(fmt.Sprintf("%s:%s", httpConfig["StatsIP"], httpConfig["StatsPort"]), nil))
-	}()
+		orgs, err := gh.ParseOrgs(githubConfig["GithubOrgMatch"])
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-	// ------------------------------------------------
+		githubber, err := gh.New(ctx, githubConfig, logger, nil)
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-	level.Info(logger).Log("version", versionString, "msg", "app started")
+		// Githubber only covers discovery, deploy keys, webhooks and the rate limit are provided by *gh.GH itself
+		myGithub := githubber.(*gh.GH)
 
-	go func() {
+		expvar.Publish("GithubRateLimitRemaining", expvar.Func(func() interface{} {
+			return myGithub.RateLimitRemaining()
+		}))
 
-		for {
+		// config repos of github repos cloned over ssh get a deploy key of their own
+		var githubGoCD gocd.ConfigRepoInterface = myGoCD
+		if githubConfig["GithubDeployKeySink"] != "" {
 
-			// keep pulling repos and add them as they are created ...
-			foundGitHubRepos, err := myGithub.Repos()
+			if gocdConfig["GoCDCloneProtocol"] != gocd.ProtocolSSH {
+				err := errors.New("github deploy keys require GOCD_CLONE_PROTOCOL=ssh")
+				level.Error(logger).Log("msg", err)
+				panic(err)
+			}
 
+			sink, err := deploykey.NewSink(ctx, githubConfig["GithubDeployKeySink"], defaultHTTPClient)
 			if err != nil {
-				level.Error(logger).Log("msg", errors.Wrap(err, "error retrieving github repos"))
+				level.Error(logger).Log("msg", err)
+				panic(err)
 			}
 
-			// -------------------------------------
-			if foundGitHubRepos != nil {
+			githubGoCD = deploykey.New(myGoCD, myGithub, sink, logger)
+		}
+
+		// config repos are tracked by the repos' ids, a renamed or transferred repo keeps its config repo
+		tracker, err := gocd.NewTracker(githubConfig["GithubTrackingPath"])
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
+
+		githubSeeds := map[string]seedSource{}
+		for _, org := range orgs {
+			seed := seedSource{name: "github org " + org.Name, prefix: org.Prefix, source: gh.NewOrgSource(myGithub, org.Name), gocd: githubGoCD, tracker: tracker}
+			githubSeeds[org.Name] = seed
+			seeds = append(seeds, seed)
+		}
+
+		// webhooks seed and remove repos right away, polling still catches anything a webhook missed
+		if githubConfig["GithubWebhookSecret"] != "" {
+
+			webhooks, err := gh.NewWebhookHandler(myGithub, githubConfig["GithubWebhookSecret"], applyChanges(logger, &seeding, githubSeeds, gocdConfig["GoCDBranch"], branchPatterns, githubConfig["GithubPullRequestTopic"]), logger)
+			if err != nil {
+				level.Error(logger).Log("msg", err)
+				panic(err)
+			}
+
+			http.Handle(githubConfig["GithubWebhookPath"], webhooks)
+		}
+	}
+
+	// gitlab is seeded when groups were set
+	if gitlabConfig["GitLabGroups"] != "" {
+
+		groups, err := source.ParseOwners(gitlabConfig["GitLabGroups"])
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-				for _, repo := range foundGitHubRepos {
+		myGitLab, err := gitlab.New(ctx, gitlabConfig, defaultHTTPClient, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-					_, err := myGoCD.GetConfigRepo(repo, githubConfig["GithubOrgMatch"])
+		for _, group := range groups {
+			seeds = append(seeds, seedSource{name: "gitlab group " + group.Name, prefix: group.Prefix, source: gitlab.NewGroupSource(myGitLab, group.Name), gocd: myGoCD})
+		}
+	}
 
-					if err != nil {
+	// bitbucket is seeded when projects were set
+	if bitbucketConfig["BitbucketProjects"] != "" {
 
-						if err.Error() != "404 Not Found" {
-							level.Warn(logger).Log("msg", errors.Wrap(err, "error retrieving gocd config repo for "+*repo.FullName))
-						}
+		projects, err := source.ParseOwners(bitbucketConfig["BitbucketProjects"])
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-						if err.Error() == "404 Not Found" {
+		myBitbucket, err := bitbucket.New(ctx, bitbucketConfig, defaultHTTPClient, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-							newRepoConfig, err := myGoCD.CreateConfigRepo(repo, githubConfig["GithubOrgMatch"])
+		for _, project := range projects {
+			seeds = append(seeds, seedSource{name: "bitbucket project " + project.Name, prefix: project.Prefix, source: bitbucket.NewProjectSource(myBitbucket, project.Name), gocd: myGoCD})
+		}
+	}
 
-							if err != nil {
+	// gitea is seeded when orgs were set
+	if giteaConfig["GiteaOrgs"] != "" {
 
-								level.Error(logger).Log("msg", errors.Wrap(err, "error creating config repo for "+*repo.FullName))
-								continue
-							}
+		orgs, err := source.ParseOwners(giteaConfig["GiteaOrgs"])
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-							level.Info(logger).Log("msg", "created "+newRepoConfig.ID)
-						}
+		myGitea, err := gitea.New(ctx, giteaConfig, defaultHTTPClient, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-					}
+		for _, org := range orgs {
+			seeds = append(seeds, seedSource{name: "gitea org " + org.Name, prefix: org.Prefix, source: gitea.NewOrgSource(myGitea, org.Name), gocd: myGoCD})
+		}
+	}
 
-				}
+	// the manifest is seeded when a path was set
+	if manifestConfig["ManifestPath"] != "" {
 
-				// -------------------------------------
+		myManifest, err := manifest.New(manifestConfig, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", err)
+			panic(err)
+		}
 
-				// get all gocd config repos
-				foundGoCDConfigRepos, err := myGoCD.GetConfigRepos()
-				if err != nil {
-					level.Error(logger).Log("msg", errors.Wrap(err, "error retrieving all config repos from gocd"))
-				}
+		seeds = append(seeds, seedSource{name: "manifest " + myManifest.Path, prefix: manifestConfig["ManifestPrefix"], source: myManifest, gocd: myGoCD})
+	}
+
+	if len(seeds) == 0 {
+		err := errors.New("nothing to seed, set GITHUB_API_KEY (or a Github App), GITLAB_GROUPS, BITBUCKET_PROJECTS, GITEA_ORGS and/or MANIFEST_PATH")
+		level.Error(logger).Log("msg", err)
+		panic(err)
+	}
+
+	// prefixes must not overlap across sources either
+	var prefixes []string
+	for _, seed := range seeds {
+		prefixes = append(prefixes, seed.prefix)
+	}
+	if err := source.ValidatePrefixes(prefixes); err != nil {
+		level.Error(logger).Log("msg", err)
+		panic(err)
+	}
 
-				err = gocd.Reconcile(myGoCD, logger, githubConfig["GithubOrgMatch"], foundGoCDConfigRepos, foundGitHubRepos)
-				if err != nil {
-					level.Error(logger).Log("msg", errors.Wrap(err, "error reconciling gocd config repos with github repos"))
+	doneChan := make(chan bool)
+	interval := 55 * time.Second
+	ticker := time.NewTicker(interval)
+
+	// ------------------------------------------------
+
+	expvar.Publish("Uptime", expvar.Func(Uptime))
+	expvar.Publish("Goroutines", expvar.Func(Goroutines))
+
+	go func() {
+		level.Info(logger).Log("msg", http.ListenAndServe(fmt.Sprintf("%s:%s", httpConfig["StatsIP"], httpConfig["StatsPort"]), nil))
+	}()
+
+	// ------------------------------------------------
+
+	level.Info(logger).Log("version", versionString, "msg", "app started")
+
+	go func() {
+
+		for {
+
+			// each org (group, ...) is discovered and reconciled on its own, so it only ever removes its own config repos
+			for _, seed := range seeds {
+
+				// don't make a rate limited source any more rate limited, it's asked again once its limit reset
+				if delay := throttled(seed); delay > 0 {
+					level.Warn(logger).Log("msg", fmt.Sprintf("skipping %s, rate limited for another %v", seed.name, delay.Round(time.Second)))
+					continue
 				}
 
-			}
+				seeding.Lock()
+				found := seedCycle(logger, seed, gocdConfig["GoCDBranch"], branchPatterns, githubConfig["GithubPullRequestTopic"])
+				seeding.Unlock()
 
-			level.Debug(logger).Log("msg", fmt.Sprintf("found repo count: %v", len(foundGitHubRepos)))
+				level.Debug(logger).Log("msg", fmt.Sprintf("found repo count for %s: %v", seed.name, found))
+			}
 			// -------------------------------------
 
+			// when every source is rate limited beyond the next tick, there's no point in waking up before the
+			// first one can be asked again
+			next := ticker.C
+			delayed := false
+			if delay := nextCycle(seeds); delay > interval {
+				level.Warn(logger).Log("msg", fmt.Sprintf("all sources are rate limited, delaying the next cycle by %v", delay.Round(time.Second)))
+				next = time.After(delay)
+				delayed = true
+			}
+
 			// use a ticker to continue, and a done channel to break out, it's neater
 			select {
 			case <-doneChan:
 				level.Info(logger).Log("msg", "shutting down goroutine")
+				ticker.Stop()
 				break
-			case <-ticker.C:
+			case <-next:
+				// the ticker kept ticking while we waited, a tick it buffered would start another cycle right away
+				if delayed {
+					ticker.Stop()
+					select {
+					case <-ticker.C:
+					default:
+					}
+					ticker = time.NewTicker(interval)
+				}
 				level.Debug(logger).Log("msg", "ticker still ticking")
 			}
 
@@ -312,7 +929,7 @@ func main() {
 
 	// stop the ticker in the go routine
 	level.Info(logger).Log("msg", fmt.Sprintf("received %v; shutting down", signal))
-	ticker.Stop()
+	cancel()
 	time.Sleep(1 * time.Second)
 	doneChan <- true
 	time.Sleep(1 * time.Second)
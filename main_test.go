@@ -1,10 +1,20 @@
 package main
 
 import (
+	"errors"
 	"io"
+	"net/http"
 	"os"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alex-leonhardt/gocd-seeder/gh"
+	"github.com/alex-leonhardt/gocd-seeder/gocd"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -127,3 +137,352 @@ func TestReadSecretFromFile(t *testing.T) {
 	}
 
 }
+
+type fakeSource struct {
+	source.Source
+	delay time.Duration
+}
+
+func (f fakeSource) Delay() time.Duration {
+	return f.delay
+}
+
+func TestNextCycle(t *testing.T) {
+	limited := seedSource{name: "limited", source: fakeSource{delay: 10 * time.Minute}}
+	limitedLonger := seedSource{name: "limited_longer", source: fakeSource{delay: 20 * time.Minute}}
+	unlimited := seedSource{name: "unlimited", source: fakeSource{}}
+	manifest := seedSource{name: "manifest", source: nil}
+
+	assert.Equal(t, time.Duration(0), nextCycle(nil))
+	assert.Equal(t, 10*time.Minute, nextCycle([]seedSource{limitedLonger, limited}))
+	assert.Equal(t, time.Duration(0), nextCycle([]seedSource{limited, unlimited}))
+	assert.Equal(t, time.Duration(0), nextCycle([]seedSource{limited, manifest}))
+}
+
+// fakeRepoSource returns a copy of its repos every time, repos with an id in moved were transferred to another of the
+// seeded owners; checked are the branches it was asked to find a config file on
+type fakeRepoSource struct {
+	repos   []*source.Repository
+	moved   map[string]bool
+	checked []string
+}
+
+func (f *fakeRepoSource) Repos() ([]*source.Repository, []*source.Repository, error) {
+	repos := []*source.Repository{}
+	for _, repo := range f.repos {
+		r := *repo
+		repos = append(repos, &r)
+	}
+	return repos, nil, nil
+}
+
+func (f *fakeRepoSource) HasConfigFile(repo *source.Repository) (bool, error) {
+	f.checked = append(f.checked, repo.Ref())
+	return true, nil
+}
+
+func (f *fakeRepoSource) Moved(id string) (bool, error) {
+	return f.moved[id], nil
+}
+
+// fakeGoCD keeps config repos in memory, and records the ids of those it created, updated and deleted
+type fakeGoCD struct {
+	mu      sync.Mutex
+	repos   map[string]gocd.ConfigRepo
+	created []string
+	updated []string
+	deleted []string
+}
+
+func newFakeGoCD() *fakeGoCD {
+	return &fakeGoCD{repos: map[string]gocd.ConfigRepo{}}
+}
+
+func (g *fakeGoCD) GetConfigRepos() ([]gocd.ConfigRepo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var repos []gocd.ConfigRepo
+	for _, repo := range g.repos {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].ID < repos[j].ID })
+	return repos, nil
+}
+
+func (g *fakeGoCD) GetConfigRepo(repo *source.Repository, prefix string) (gocd.ConfigRepo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	configRepo, ok := g.repos[gocd.ConfigRepoID(repo, prefix)]
+	if !ok {
+		return gocd.ConfigRepo{}, errors.New("404 Not Found")
+	}
+	return configRepo, nil
+}
+
+func (g *fakeGoCD) CreateConfigRepo(repo *source.Repository, prefix string) (gocd.ConfigRepo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	configRepo := gocd.ConfigRepo{ID: gocd.ConfigRepoID(repo, prefix)}
+	configRepo.Material.Attributes.Name = repo.Name
+	configRepo.Material.Attributes.URL = repo.CloneURL
+	g.repos[configRepo.ID] = configRepo
+	g.created = append(g.created, configRepo.ID)
+	return configRepo, nil
+}
+
+func (g *fakeGoCD) UpdateConfigRepo(existing gocd.ConfigRepo, repo *source.Repository, prefix string) (gocd.ConfigRepo, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if existing.Material.Attributes.Name == repo.Name && existing.Material.Attributes.URL == repo.CloneURL {
+		return existing, false, nil
+	}
+	existing.Material.Attributes.Name = repo.Name
+	existing.Material.Attributes.URL = repo.CloneURL
+	g.repos[existing.ID] = existing
+	g.updated = append(g.updated, existing.ID)
+	return existing, true, nil
+}
+
+func (g *fakeGoCD) DeleteConfigRepo(configRepo *gocd.ConfigRepo, prefix string) (*http.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.repos, configRepo.ID)
+	g.deleted = append(g.deleted, configRepo.ID)
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func (g *fakeGoCD) calls() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.created) + len(g.updated) + len(g.deleted)
+}
+
+func fakeRepo(owner string, name string) *source.Repository {
+	return &source.Repository{ID: "1", Name: name, FullName: owner + "/" + name, CloneURL: "https://github.com/" + owner + "/" + name + ".git"}
+}
+
+func fakeGithubRepo(owner string, name string) *github.Repository {
+	return &github.Repository{
+		ID:       github.Int64(1),
+		Name:     github.String(name),
+		FullName: github.String(owner + "/" + name),
+		CloneURL: github.String("https://github.com/" + owner + "/" + name + ".git"),
+	}
+}
+
+func TestSeedRepoConfigFileBranch(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	var branchTests = []struct {
+		name    string
+		branch  string
+		repo    *source.Repository
+		checked string
+	}{
+		{
+			name:    "default_branch",
+			repo:    &source.Repository{Name: "one", DefaultBranch: "main"},
+			checked: "main",
+		},
+		{
+			name:    "seeder_branch",
+			branch:  "develop",
+			repo:    &source.Repository{Name: "one", DefaultBranch: "main"},
+			checked: "develop",
+		},
+		{
+			name:    "repo_branch",
+			branch:  "develop",
+			repo:    &source.Repository{Name: "one", DefaultBranch: "main", Branch: "release"},
+			checked: "release",
+		},
+	}
+
+	for _, tt := range branchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFakeGoCD()
+			src := &fakeRepoSource{}
+			seed := seedSource{name: "github org gooflix", prefix: "gooflix", source: src, gocd: g}
+
+			original := *tt.repo
+			seedRepo(logger, seed, tt.repo, tt.branch)
+
+			assert.Equal(t, []string{tt.checked}, src.checked)
+			assert.Equal(t, []string{"gooflix-one"}, g.created)
+			assert.Equal(t, original, *tt.repo)
+		})
+	}
+}
+
+func TestSeedCycleRename(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracker, err := gocd.NewTracker("")
+	assert.NoError(t, err)
+
+	g := newFakeGoCD()
+	src := &fakeRepoSource{repos: []*source.Repository{fakeRepo("gooflix", "one")}}
+	seed := seedSource{name: "github org gooflix", prefix: "gooflix", source: src, gocd: g, tracker: tracker}
+
+	assert.Equal(t, 1, seedCycle(logger, seed, "", nil, ""))
+	assert.Equal(t, []string{"gooflix-one"}, g.created)
+
+	// the tracked config repo is resolved by the repo's id, it's updated in place rather than replaced
+	src.repos = []*source.Repository{fakeRepo("gooflix", "uno")}
+	assert.Equal(t, 1, seedCycle(logger, seed, "", nil, ""))
+
+	assert.Equal(t, []string{"gooflix-one"}, g.created)
+	assert.Equal(t, []string{"gooflix-one"}, g.updated)
+	assert.Empty(t, g.deleted)
+	assert.Equal(t, "uno", g.repos["gooflix-one"].Material.Attributes.Name)
+	assert.Equal(t, "https://github.com/gooflix/uno.git", g.repos["gooflix-one"].Material.Attributes.URL)
+}
+
+func TestSeedCycleUntrackedRename(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	g := newFakeGoCD()
+	src := &fakeRepoSource{repos: []*source.Repository{fakeRepo("gooflix", "one")}}
+	seed := seedSource{name: "github org gooflix", prefix: "gooflix", source: src, gocd: g}
+
+	seedCycle(logger, seed, "", nil, "")
+
+	// w/o a tracker the renamed repo is a new repo, and the old one is gone
+	src.repos = []*source.Repository{fakeRepo("gooflix", "uno")}
+	seedCycle(logger, seed, "", nil, "")
+
+	assert.Equal(t, []string{"gooflix-one", "gooflix-uno"}, g.created)
+	assert.Empty(t, g.updated)
+	assert.Equal(t, []string{"gooflix-one"}, g.deleted)
+}
+
+func TestSeedCycleTransfer(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	t.Run("to_a_seeded_org", func(t *testing.T) {
+		tracker, err := gocd.NewTracker("")
+		assert.NoError(t, err)
+
+		g := newFakeGoCD()
+		from := &fakeRepoSource{repos: []*source.Repository{fakeRepo("gooflix", "one")}, moved: map[string]bool{}}
+		to := &fakeRepoSource{repos: []*source.Repository{}}
+		fromSeed := seedSource{name: "github org gooflix", prefix: "gooflix", source: from, gocd: g, tracker: tracker}
+		toSeed := seedSource{name: "github org acme", prefix: "acme", source: to, gocd: g, tracker: tracker}
+
+		seedCycle(logger, fromSeed, "", nil, "")
+		seedCycle(logger, toSeed, "", nil, "")
+		assert.Equal(t, []string{"gooflix-one"}, g.created)
+
+		from.repos = []*source.Repository{}
+		from.moved["1"] = true
+		to.repos = []*source.Repository{fakeRepo("acme", "one")}
+
+		// the org it left keeps the config repo, the org it moved to updates it
+		seedCycle(logger, fromSeed, "", nil, "")
+		seedCycle(logger, toSeed, "", nil, "")
+		seedCycle(logger, fromSeed, "", nil, "")
+
+		assert.Equal(t, []string{"gooflix-one"}, g.created)
+		assert.Equal(t, []string{"gooflix-one"}, g.updated)
+		assert.Empty(t, g.deleted)
+		assert.Equal(t, "https://github.com/acme/one.git", g.repos["gooflix-one"].Material.Attributes.URL)
+	})
+
+	t.Run("out_of_the_seeded_orgs", func(t *testing.T) {
+		tracker, err := gocd.NewTracker("")
+		assert.NoError(t, err)
+
+		g := newFakeGoCD()
+		from := &fakeRepoSource{repos: []*source.Repository{fakeRepo("gooflix", "one")}}
+		fromSeed := seedSource{name: "github org gooflix", prefix: "gooflix", source: from, gocd: g, tracker: tracker}
+
+		seedCycle(logger, fromSeed, "", nil, "")
+
+		from.repos = []*source.Repository{}
+		seedCycle(logger, fromSeed, "", nil, "")
+
+		assert.Equal(t, []string{"gooflix-one"}, g.created)
+		assert.Equal(t, []string{"gooflix-one"}, g.deleted)
+	})
+}
+
+func TestApplyChangesRename(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	renamed := []gh.Change{
+		{Org: "gooflix", Repo: fakeGithubRepo("gooflix", "one"), Action: gh.PolicyRemove, Moved: true},
+		{Org: "gooflix", Repo: fakeGithubRepo("gooflix", "uno"), Action: gh.PolicySeed},
+	}
+
+	t.Run("tracked", func(t *testing.T) {
+		tracker, err := gocd.NewTracker("")
+		assert.NoError(t, err)
+
+		g := newFakeGoCD()
+		seeds := map[string]seedSource{"gooflix": {name: "github org gooflix", prefix: "gooflix", source: &fakeRepoSource{}, gocd: g, tracker: tracker}}
+		apply := applyChanges(logger, &sync.Mutex{}, seeds, "", nil, "")
+
+		apply([]gh.Change{{Org: "gooflix", Repo: fakeGithubRepo("gooflix", "one"), Action: gh.PolicySeed}})
+		apply(renamed)
+
+		assert.Equal(t, []string{"gooflix-one"}, g.created)
+		assert.Equal(t, []string{"gooflix-one"}, g.updated)
+		assert.Empty(t, g.deleted)
+		assert.Equal(t, "uno", g.repos["gooflix-one"].Material.Attributes.Name)
+	})
+
+	t.Run("untracked", func(t *testing.T) {
+		g := newFakeGoCD()
+		seeds := map[string]seedSource{"gooflix": {name: "github org gooflix", prefix: "gooflix", source: &fakeRepoSource{}, gocd: g}}
+		apply := applyChanges(logger, &sync.Mutex{}, seeds, "", nil, "")
+
+		apply([]gh.Change{{Org: "gooflix", Repo: fakeGithubRepo("gooflix", "one"), Action: gh.PolicySeed}})
+		apply(renamed)
+
+		assert.Equal(t, []string{"gooflix-one", "gooflix-uno"}, g.created)
+		assert.Equal(t, []string{"gooflix-one"}, g.deleted)
+	})
+
+	t.Run("unknown_org", func(t *testing.T) {
+		g := newFakeGoCD()
+		seeds := map[string]seedSource{"gooflix": {name: "github org gooflix", prefix: "gooflix", source: &fakeRepoSource{}, gocd: g}}
+		apply := applyChanges(logger, &sync.Mutex{}, seeds, "", nil, "")
+
+		apply([]gh.Change{{Org: "acme", Repo: fakeGithubRepo("acme", "one"), Action: gh.PolicySeed}})
+
+		assert.Equal(t, 0, g.calls())
+	})
+}
+
+func TestApplyChangesWaitsForSeeding(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	g := newFakeGoCD()
+	seeds := map[string]seedSource{"gooflix": {name: "github org gooflix", prefix: "gooflix", source: &fakeRepoSource{}, gocd: g}}
+
+	var seeding sync.Mutex
+	apply := applyChanges(logger, &seeding, seeds, "", nil, "")
+
+	// polling holds seeding while it seeds, the webhook's changes wait for it
+	seeding.Lock()
+	done := make(chan bool)
+	go func() {
+		apply([]gh.Change{{Org: "gooflix", Repo: fakeGithubRepo("gooflix", "one"), Action: gh.PolicySeed}})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("changes applied while seeding")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, 0, g.calls())
+
+	seeding.Unlock()
+	<-done
+	assert.Equal(t, []string{"gooflix-one"}, g.created)
+}
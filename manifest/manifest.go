@@ -0,0 +1,140 @@
+// Package manifest reads the repos to seed from a static YAML (or JSON) file, for repos that cannot carry a topic,
+// e.g. vendor mirrors or repos on hosts the seeder cannot query.
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// names end up in GoCD config repo IDs
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+type entry struct {
+	Name     string `yaml:"name"`
+	CloneURL string `yaml:"clone_url"`
+	Branch   string `yaml:"branch"`
+	Plugin   string `yaml:"plugin"`
+}
+
+type manifestFile struct {
+	Repos []entry `yaml:"repos"`
+}
+
+// Manifest is a source.Source for the repos listed in a manifest file, the file is re-read when it changes
+type Manifest struct {
+	Path    string
+	modTime time.Time
+	size    int64
+	repos   []*source.Repository
+	mu      sync.Mutex
+	logger  log.Logger
+}
+
+// New returns a Manifest for the file at config["ManifestPath"], the file is read right away so a broken manifest
+// is noticed on startup
+func New(config map[string]string, logger log.Logger) (*Manifest, error) {
+
+	if config["ManifestPath"] == "" {
+		return nil, errors.Wrap(errors.New("missing manifest path"), "environment variable not set")
+	}
+
+	m := &Manifest{
+		Path:   config["ManifestPath"],
+		logger: logger,
+	}
+
+	if _, _, err := m.Repos(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Repos implements source.Source, the manifest is re-read when its modification time or size changed; a manifest
+// that cannot be read returns an error, so config repos are not removed because of a typo
+func (m *Manifest) Repos() ([]*source.Repository, []*source.Repository, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to read manifest")
+	}
+
+	if m.repos != nil && info.ModTime().Equal(m.modTime) && info.Size() == m.size {
+		return m.repos, nil, nil
+	}
+
+	repos, err := Load(m.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.repos = repos
+	m.modTime = info.ModTime()
+	m.size = info.Size()
+	level.Info(m.logger).Log("msg", fmt.Sprintf("read %d repos from manifest %s", len(repos), m.Path))
+
+	return m.repos, nil, nil
+}
+
+// HasConfigFile implements source.Source, repos are listed in the manifest on purpose and their hosts may not be
+// reachable, so they are always considered configured
+func (m *Manifest) HasConfigFile(repo *source.Repository) (bool, error) {
+	return true, nil
+}
+
+// Load reads and validates a manifest file, JSON is valid YAML so both are accepted
+func Load(path string) ([]*source.Repository, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read manifest")
+	}
+
+	var mf manifestFile
+	if err := yaml.UnmarshalStrict(data, &mf); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse manifest %s", path)
+	}
+
+	var repos = make([]*source.Repository, 0, len(mf.Repos))
+	seen := map[string]bool{}
+
+	for i, e := range mf.Repos {
+
+		if !validName.MatchString(e.Name) {
+			return nil, fmt.Errorf("invalid name %q of repo %d in manifest %s, must only contain letters, digits, '_', '-' and '.'", e.Name, i+1, path)
+		}
+		if e.CloneURL == "" {
+			return nil, fmt.Errorf("missing clone_url of repo %s in manifest %s", e.Name, path)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("%s is listed more than once in manifest %s", e.Name, path)
+		}
+		seen[e.Name] = true
+
+		repos = append(repos, &source.Repository{
+			// the name is all a manifest entry has to identify it
+			ID:       e.Name,
+			Name:     e.Name,
+			FullName: e.Name,
+			CloneURL: e.CloneURL,
+			Branch:   e.Branch,
+			PluginID: e.Plugin,
+		})
+	}
+
+	return repos, nil
+}
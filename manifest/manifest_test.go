@@ -0,0 +1,110 @@
+package manifest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alex-leonhardt/gocd-seeder/manifest"
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var loadTests = []struct {
+		name    string
+		content string
+		repos   []*source.Repository
+		err     bool
+	}{
+		{
+			name: "yaml",
+			content: `
+repos:
+  - name: vendored
+    clone_url: https://git.vendor.example.com/vendored.git
+    branch: main
+    plugin: json.config.plugin
+  - name: mirror
+    clone_url: https://mirror.example.com/mirror.git
+`,
+			repos: []*source.Repository{
+				{ID: "vendored", Name: "vendored", FullName: "vendored", CloneURL: "https://git.vendor.example.com/vendored.git", Branch: "main", PluginID: "json.config.plugin"},
+				{ID: "mirror", Name: "mirror", FullName: "mirror", CloneURL: "https://mirror.example.com/mirror.git"},
+			},
+		},
+		{
+			name:    "json",
+			content: `{"repos": [{"name": "mirror", "clone_url": "https://mirror.example.com/mirror.git"}]}`,
+			repos: []*source.Repository{
+				{ID: "mirror", Name: "mirror", FullName: "mirror", CloneURL: "https://mirror.example.com/mirror.git"},
+			},
+		},
+		{name: "empty", content: ``, repos: []*source.Repository{}},
+		{name: "missing_name", content: `{"repos": [{"clone_url": "https://mirror.example.com/mirror.git"}]}`, err: true},
+		{name: "invalid_name", content: `{"repos": [{"name": "a/b", "clone_url": "https://mirror.example.com/mirror.git"}]}`, err: true},
+		{name: "missing_clone_url", content: `{"repos": [{"name": "mirror"}]}`, err: true},
+		{name: "duplicate", content: `{"repos": [{"name": "mirror", "clone_url": "a"}, {"name": "mirror", "clone_url": "b"}]}`, err: true},
+		{name: "unknown_field", content: `{"repos": [{"name": "mirror", "url": "a"}]}`, err: true},
+	}
+
+	for _, tt := range loadTests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".yaml")
+			assert.Nil(t, ioutil.WriteFile(path, []byte(tt.content), 0644))
+
+			repos, err := manifest.Load(path)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.repos, repos)
+		})
+	}
+}
+
+func TestReposReloaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"repos": [{"name": "one", "clone_url": "a"}]}`), 0644))
+
+	m, err := manifest.New(map[string]string{"ManifestPath": path}, log.NewNopLogger())
+	assert.Nil(t, err)
+
+	repos, skipped, err := m.Repos()
+	assert.Nil(t, err)
+	assert.Nil(t, skipped)
+	assert.Len(t, repos, 1)
+
+	// a broken manifest is an error, rather than no repos
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"repos": [{"name": "one"`), 0644))
+	assert.Nil(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+
+	_, _, err = m.Repos()
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"repos": [{"name": "one", "clone_url": "a"}, {"name": "two", "clone_url": "b"}]}`), 0644))
+	assert.Nil(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+
+	repos, _, err = m.Repos()
+	assert.Nil(t, err)
+	assert.Len(t, repos, 2)
+}
+
+func TestNewMissingFile(t *testing.T) {
+	m, err := manifest.New(map[string]string{"ManifestPath": "/does/not/exist.yaml"}, log.NewNopLogger())
+
+	assert.NotNil(t, err)
+	assert.Nil(t, m)
+}
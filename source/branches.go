@@ -0,0 +1,206 @@
+package source
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// invalidVariant matches what GoCD does not allow in a config repo's id
+var invalidVariant = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// BranchLister is implemented by sources that can list the branches of repos
+type BranchLister interface {
+	// Branches returns the names of the repo's branches
+	Branches(repo *Repository) ([]string, error)
+}
+
+// ParseBranchPatterns parses a comma separated list of branch globs, e.g. "release/*,hotfix/*"
+func ParseBranchPatterns(value string) ([]string, error) {
+
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if err := validBranchPattern(pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// ExpandBranches adds a repo with its own Branch and Variant for each of a repo's branches that matches its branch
+// patterns, or the seeder's patterns when the repo has none, except for the branch its own config repo reads, see
+// BaseBranch; repos whose branches cannot be listed are returned separately, each with its error, so their existing
+// config repos can be kept
+func ExpandBranches(src Source, repos []*Repository, patterns []string, branch string) ([]*Repository, []*Repository, []error) {
+
+	lister, ok := src.(BranchLister)
+	if !ok {
+		return repos, nil, nil
+	}
+
+	expanded := make([]*Repository, 0, len(repos))
+	var failed []*Repository
+	var errs []error
+
+	for _, repo := range repos {
+
+		repoPatterns := repo.BranchPatterns
+		if repoPatterns == nil {
+			repoPatterns = patterns
+		}
+		if len(repoPatterns) == 0 || repo.DefaultBranch == "" {
+			expanded = append(expanded, repo)
+			continue
+		}
+
+		branches, err := lister.Branches(repo)
+		if err != nil {
+			failed = append(failed, repo)
+			errs = append(errs, errors.Wrapf(err, "unable to list branches of %s", repo.FullName))
+			continue
+		}
+
+		expanded = append(expanded, repo)
+
+		// different branches can end up as the same variant, e.g. release/1 and release-1, the first one wins; pr-*
+		// is for pull requests
+		base := BaseBranch(repo, branch)
+		variants := map[string]bool{}
+		for _, name := range branches {
+			if name == base || !matchBranch(repoPatterns, name) {
+				continue
+			}
+
+			variant := BranchVariant(name)
+			if variants[variant] || strings.HasPrefix(variant, "pr-") {
+				errs = append(errs, fmt.Errorf("branch %s of %s has the same id as another branch or a pull request, skipping it", name, repo.FullName))
+				continue
+			}
+			variants[variant] = true
+
+			b := *repo
+			b.Branch = name
+			b.Variant = variant
+			expanded = append(expanded, &b)
+		}
+	}
+
+	return expanded, failed, errs
+}
+
+// BaseBranch returns the branch the repo's own config repo reads pipelines from, given the seeder's branch (which may
+// be empty): the repo's own (e.g. from its overrides), the seeder's, or the repo's default branch, in that order
+func BaseBranch(repo *Repository, branch string) string {
+	switch {
+	case repo.Branch != "":
+		return repo.Branch
+	case branch != "":
+		return branch
+	}
+	return repo.DefaultBranch
+}
+
+// BranchVariant returns the Variant of a branch's config repo, i.e. the branch's name w/o what GoCD does not allow in
+// an id, e.g. release-1.x for release/1.x
+func BranchVariant(branch string) string {
+	return strings.Trim(invalidVariant.ReplaceAllString(branch, "-"), "-")
+}
+
+// matchBranch returns true if the branch matches any of the globs
+func matchBranch(patterns []string, branch string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, branch); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validBranchPattern returns an error if the glob is malformed
+func validBranchPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid branch pattern %q", pattern)
+	}
+	return nil
+}
+
+// PullRequest is an open pull request whose head branch is in the repo itself
+type PullRequest struct {
+	Number int
+	Branch string
+}
+
+// PullRequestLister is implemented by sources that can list the open pull requests of repos
+type PullRequestLister interface {
+	// PullRequests returns the repo's open pull requests, w/o those from forks
+	PullRequests(repo *Repository) ([]PullRequest, error)
+}
+
+// ExpandPullRequests adds a repo with its own Branch and Variant for each open pull request of the repos that carry
+// the topic, unless the pull request's branch already has a config repo, e.g. a long-lived branch; repos whose pull
+// requests cannot be listed are returned separately, each with its error, so their existing config repos can be kept
+func ExpandPullRequests(src Source, repos []*Repository, topic string, branch string) ([]*Repository, []*Repository, []error) {
+
+	lister, ok := src.(PullRequestLister)
+	if !ok || topic == "" {
+		return repos, nil, nil
+	}
+
+	// the branches that have a config repo already, by repo; GoCD rejects a second config repo of the same branch
+	seeded := map[string]map[string]bool{}
+	for _, repo := range repos {
+		if seeded[repo.FullName] == nil {
+			seeded[repo.FullName] = map[string]bool{}
+		}
+		seeded[repo.FullName][BaseBranch(repo, branch)] = true
+	}
+
+	expanded := make([]*Repository, 0, len(repos))
+	var failed []*Repository
+	var errs []error
+
+	for _, repo := range repos {
+
+		// a branch's config repo doesn't get pull requests of its own, the repo's does
+		if repo.Variant != "" || !HasTopic(repo.Topics, topic) {
+			expanded = append(expanded, repo)
+			continue
+		}
+
+		prs, err := lister.PullRequests(repo)
+		if err != nil {
+			failed = append(failed, repo)
+			errs = append(errs, errors.Wrapf(err, "unable to list pull requests of %s", repo.FullName))
+			continue
+		}
+
+		expanded = append(expanded, repo)
+
+		for _, pr := range prs {
+			if seeded[repo.FullName][pr.Branch] {
+				continue
+			}
+
+			p := *repo
+			p.Branch = pr.Branch
+			p.Variant = PullRequestVariant(pr.Number)
+			expanded = append(expanded, &p)
+		}
+	}
+
+	return expanded, failed, errs
+}
+
+// PullRequestVariant returns the Variant of a pull request's config repo, e.g. pr-42
+func PullRequestVariant(number int) string {
+	return fmt.Sprintf("pr-%d", number)
+}
@@ -0,0 +1,134 @@
+package source_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBranchPatterns(t *testing.T) {
+	patterns, err := source.ParseBranchPatterns("release/*, hotfix/*,")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"release/*", "hotfix/*"}, patterns)
+
+	_, err = source.ParseBranchPatterns("release/[")
+	assert.NotNil(t, err)
+}
+
+type fakeLister struct {
+	fakeFetcher
+	branches map[string][]string
+}
+
+func (f *fakeLister) Branches(repo *source.Repository) ([]string, error) {
+	if repo.Name == "broken" {
+		return nil, errors.New("500 Internal Server Error")
+	}
+	return f.branches[repo.Name], nil
+}
+
+func TestExpandBranches(t *testing.T) {
+	src := &fakeLister{branches: map[string][]string{
+		"service": {"main", "release/1.x", "release-1.x", "release/2.x", "feature/x"},
+		"own":     {"main", "release/1.x", "stable"},
+	}}
+
+	repos := []*source.Repository{
+		{Name: "service", DefaultBranch: "main"},
+		{Name: "own", DefaultBranch: "main", BranchPatterns: []string{"stable"}},
+		{Name: "empty"},
+		{Name: "broken", DefaultBranch: "main"},
+	}
+
+	expanded, failed, errs := source.ExpandBranches(src, repos, []string{"release/*", "release-*"}, "")
+
+	// release-1.x has the same id as release/1.x
+	assert.Len(t, errs, 2)
+	assert.Equal(t, []*source.Repository{repos[3]}, failed)
+
+	var branches []string
+	for _, repo := range expanded {
+		branches = append(branches, repo.Name+":"+repo.Ref()+":"+repo.Variant)
+	}
+	assert.Equal(t, []string{
+		"service:main:",
+		"service:release/1.x:release-1.x",
+		"service:release/2.x:release-2.x",
+		"own:main:",
+		"own:stable:stable",
+		"empty::",
+	}, branches)
+}
+
+func TestExpandBranchesSeederBranch(t *testing.T) {
+	src := &fakeLister{branches: map[string][]string{
+		"service": {"main", "release/1.x", "release/2.x"},
+	}}
+
+	repos := []*source.Repository{
+		{Name: "service", DefaultBranch: "main"},
+		{Name: "service", DefaultBranch: "main", Branch: "release/2.x"},
+	}
+
+	// the config repo of the repo itself reads release/1.x, seeding the branch again would duplicate its material
+	expanded, _, errs := source.ExpandBranches(src, repos[:1], []string{"release/*"}, "release/1.x")
+	assert.Empty(t, errs)
+
+	var branches []string
+	for _, repo := range expanded {
+		branches = append(branches, repo.Ref()+":"+repo.Variant)
+	}
+	assert.Equal(t, []string{"main:", "release/2.x:release-2.x"}, branches)
+
+	// the repo's own branch wins over the seeder's
+	expanded, _, _ = source.ExpandBranches(src, repos[1:], []string{"release/*"}, "release/1.x")
+
+	branches = nil
+	for _, repo := range expanded {
+		branches = append(branches, repo.Ref()+":"+repo.Variant)
+	}
+	assert.Equal(t, []string{"release/2.x:", "release/1.x:release-1.x"}, branches)
+}
+
+func TestBranchVariant(t *testing.T) {
+	assert.Equal(t, "release-1.x", source.BranchVariant("release/1.x"))
+	assert.Equal(t, "feature-a-b", source.BranchVariant("feature/a+b"))
+}
+
+func (f *fakeLister) PullRequests(repo *source.Repository) ([]source.PullRequest, error) {
+	if repo.Name == "broken" {
+		return nil, errors.New("500 Internal Server Error")
+	}
+	return []source.PullRequest{{Number: 42, Branch: "feature/x"}, {Number: 43, Branch: "release/1.x"}, {Number: 44, Branch: "develop"}}, nil
+}
+
+func TestExpandPullRequests(t *testing.T) {
+	repos := []*source.Repository{
+		{Name: "previews", FullName: "myorg/previews", DefaultBranch: "main", Topics: []string{"ci-gocd", "ci-gocd-pr"}},
+		{Name: "previews", FullName: "myorg/previews", DefaultBranch: "main", Topics: []string{"ci-gocd", "ci-gocd-pr"}, Branch: "release/1.x", Variant: "release-1.x"},
+		{Name: "plain", FullName: "myorg/plain", Topics: []string{"ci-gocd"}},
+		{Name: "broken", FullName: "myorg/broken", Topics: []string{"ci-gocd-pr"}},
+	}
+
+	// release/1.x has a config repo as a long-lived branch, develop is the seeder's branch the repo's one reads
+	expanded, failed, errs := source.ExpandPullRequests(&fakeLister{}, repos, "ci-gocd-pr", "develop")
+	assert.Len(t, errs, 1)
+	assert.Equal(t, []*source.Repository{repos[3]}, failed)
+
+	var variants []string
+	for _, repo := range expanded {
+		variants = append(variants, repo.Name+":"+repo.Ref()+":"+repo.Variant)
+	}
+	assert.Equal(t, []string{
+		"previews:main:",
+		"previews:feature/x:pr-42",
+		"previews:release/1.x:release-1.x",
+		"plain::",
+	}, variants)
+
+	// w/o a topic no repo has pull requests
+	expanded, _, _ = source.ExpandPullRequests(&fakeLister{}, repos, "", "")
+	assert.Equal(t, repos, expanded)
+}
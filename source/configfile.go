@@ -0,0 +1,29 @@
+package source
+
+import (
+	"path"
+	"strings"
+)
+
+// DefaultConfigFilePattern matches the files the GoCD yaml config plugin picks up by default
+const DefaultConfigFilePattern = "*.gocd.yaml"
+
+// MatchConfigFile returns true if the file matches the config file pattern; patterns w/o a "/" match a file's name
+// anywhere in the repo, patterns with a "/" match the file's full path; a leading "**/" (as in GoCD's patterns)
+// matches any directory
+func MatchConfigFile(pattern string, file string) bool {
+	pattern = strings.TrimPrefix(pattern, "**/")
+	if !strings.Contains(pattern, "/") {
+		file = path.Base(file)
+	}
+	matched, _ := path.Match(pattern, file)
+	return matched
+}
+
+// ConfigFilePattern returns the repo's own config file pattern, if it has one, else the fallback
+func (r *Repository) ConfigFilePattern(fallback string) string {
+	if r.FilePattern != "" {
+		return r.FilePattern
+	}
+	return fallback
+}
@@ -0,0 +1,141 @@
+package source
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// OverridesFile is the file in a repo's default branch that overrides how its config repo is created
+const OverridesFile = ".gocd-seeder.yaml"
+
+var (
+	// plugin ids and material names are restricted by GoCD
+	validPluginID     = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+	validMaterialName = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,254}$`)
+)
+
+// Overrides are the settings a repo can override in its OverridesFile
+type Overrides struct {
+	Branch       string `yaml:"branch"`
+	PluginID     string `yaml:"plugin_id"`
+	FilePattern  string `yaml:"file_pattern"`
+	MaterialName string `yaml:"material_name"`
+	AutoUpdate   *bool  `yaml:"auto_update"`
+	// Branches replaces the seeder's branch patterns, an empty list seeds the repo's branch only
+	Branches []string `yaml:"branches"`
+}
+
+// FileFetcher is implemented by sources that can read files from repos
+type FileFetcher interface {
+	// FetchFile returns the content of the file in the repo's default branch, and false if there is no such file
+	FetchFile(repo *Repository, file string) ([]byte, bool, error)
+}
+
+// ParseOverrides parses and validates the content of an OverridesFile
+func ParseOverrides(data []byte) (*Overrides, error) {
+
+	var o Overrides
+	if err := yaml.UnmarshalStrict(data, &o); err != nil {
+		return nil, errors.Wrap(err, "unable to parse "+OverridesFile)
+	}
+
+	if o.Branch != "" && !validBranch(o.Branch) {
+		return nil, fmt.Errorf("invalid branch %q", o.Branch)
+	}
+	if o.PluginID != "" && !validPluginID.MatchString(o.PluginID) {
+		return nil, fmt.Errorf("invalid plugin_id %q", o.PluginID)
+	}
+	if o.FilePattern != "" {
+		if _, err := path.Match(strings.TrimPrefix(o.FilePattern, "**/"), ""); err != nil {
+			return nil, fmt.Errorf("invalid file_pattern %q", o.FilePattern)
+		}
+	}
+	for _, pattern := range o.Branches {
+		if err := validBranchPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	if o.MaterialName != "" && !validMaterialName.MatchString(o.MaterialName) {
+		return nil, fmt.Errorf("invalid material_name %q, must only contain letters, digits, '_', '-' and '.'", o.MaterialName)
+	}
+
+	return &o, nil
+}
+
+// Apply sets the overrides on the repo
+func (o *Overrides) Apply(repo *Repository) {
+	if o.Branch != "" {
+		repo.Branch = o.Branch
+	}
+	if o.PluginID != "" {
+		repo.PluginID = o.PluginID
+	}
+	if o.FilePattern != "" {
+		repo.FilePattern = o.FilePattern
+	}
+	if o.MaterialName != "" {
+		repo.MaterialName = o.MaterialName
+	}
+	if o.AutoUpdate != nil {
+		repo.AutoUpdate = o.AutoUpdate
+	}
+	if o.Branches != nil {
+		repo.BranchPatterns = o.Branches
+	}
+}
+
+// ApplyOverrides reads the OverridesFile of each repo, if the source can read files, and applies it; repos whose
+// file cannot be read or is invalid are returned separately, each with its error, so they can be reported and
+// skipped w/o blocking the other repos
+func ApplyOverrides(src Source, repos []*Repository) ([]*Repository, []*Repository, []error) {
+
+	fetcher, ok := src.(FileFetcher)
+	if !ok {
+		return repos, nil, nil
+	}
+
+	valid := make([]*Repository, 0, len(repos))
+	var invalid []*Repository
+	var errs []error
+
+	for _, repo := range repos {
+
+		data, found, err := fetcher.FetchFile(repo, OverridesFile)
+		if err != nil {
+			invalid = append(invalid, repo)
+			errs = append(errs, errors.Wrapf(err, "unable to read %s of %s", OverridesFile, repo.FullName))
+			continue
+		}
+
+		if found {
+			overrides, err := ParseOverrides(data)
+			if err != nil {
+				invalid = append(invalid, repo)
+				errs = append(errs, errors.Wrapf(err, "invalid %s in %s", OverridesFile, repo.FullName))
+				continue
+			}
+			overrides.Apply(repo)
+		}
+
+		valid = append(valid, repo)
+	}
+
+	return valid, invalid, errs
+}
+
+// validBranch checks the rules of git check-ref-format that matter for a branch name in a config file
+func validBranch(branch string) bool {
+	if strings.HasPrefix(branch, "-") || strings.HasPrefix(branch, "/") || strings.HasSuffix(branch, "/") ||
+		strings.HasSuffix(branch, ".lock") || strings.HasSuffix(branch, ".") {
+		return false
+	}
+	if strings.Contains(branch, "..") || strings.Contains(branch, "@{") || strings.Contains(branch, "//") {
+		return false
+	}
+	return !strings.ContainsAny(branch, " ~^:?*[\\\t\n")
+}
@@ -0,0 +1,83 @@
+package source_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOverrides(t *testing.T) {
+	var parseOverridesTests = []struct {
+		name string
+		data string
+		err  bool
+	}{
+		{name: "empty", data: ""},
+		{name: "all", data: "branch: release/1.x\nplugin_id: json.config.plugin\nfile_pattern: \"**/*.gopipeline.json\"\nmaterial_name: my-repo\nauto_update: false\n"},
+		{name: "unknown_key", data: "brnach: main\n", err: true},
+		{name: "not_yaml", data: "branch: [main\n", err: true},
+		{name: "invalid_branch", data: "branch: main..dev\n", err: true},
+		{name: "option_branch", data: "branch: --upload-pack=x\n", err: true},
+		{name: "invalid_plugin_id", data: "plugin_id: yaml config\n", err: true},
+		{name: "invalid_file_pattern", data: "file_pattern: \"ci/[\"\n", err: true},
+		{name: "invalid_material_name", data: "material_name: my repo\n", err: true},
+	}
+
+	for _, tt := range parseOverridesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := source.ParseOverrides([]byte(tt.data))
+			assert.Equal(t, tt.err, err != nil)
+		})
+	}
+}
+
+type fakeFetcher struct {
+	files map[string]string
+}
+
+func (f *fakeFetcher) Repos() ([]*source.Repository, []*source.Repository, error) {
+	return nil, nil, nil
+}
+
+func (f *fakeFetcher) HasConfigFile(*source.Repository) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeFetcher) FetchFile(repo *source.Repository, file string) ([]byte, bool, error) {
+	if repo.Name == "broken" {
+		return nil, false, errors.New("500 Internal Server Error")
+	}
+	content, ok := f.files[repo.Name]
+	return []byte(content), ok, nil
+}
+
+func TestApplyOverrides(t *testing.T) {
+	src := &fakeFetcher{files: map[string]string{
+		"overridden": "branch: main\nmaterial_name: renamed\nauto_update: false\n",
+		"invalid":    "branch: \"main branch\"\n",
+	}}
+
+	repos := []*source.Repository{{Name: "plain"}, {Name: "overridden"}, {Name: "invalid"}, {Name: "broken"}}
+
+	valid, invalid, errs := source.ApplyOverrides(src, repos)
+	assert.Len(t, errs, 2)
+	assert.Len(t, invalid, 2)
+	assert.Equal(t, "invalid", invalid[0].Name)
+	assert.Equal(t, "broken", invalid[1].Name)
+
+	assert.Len(t, valid, 2)
+	assert.Equal(t, &source.Repository{Name: "plain"}, valid[0])
+	assert.Equal(t, "main", valid[1].Branch)
+	assert.Equal(t, "renamed", valid[1].MaterialName)
+	if assert.NotNil(t, valid[1].AutoUpdate) {
+		assert.False(t, *valid[1].AutoUpdate)
+	}
+}
+
+func TestMatchConfigFileDoubleStar(t *testing.T) {
+	assert.True(t, source.MatchConfigFile("**/*.gocd.yaml", "ci/ci.gocd.yaml"))
+	assert.True(t, source.MatchConfigFile("**/*.gocd.yaml", "ci.gocd.yaml"))
+	assert.False(t, source.MatchConfigFile("**/*.gocd.yaml", "ci.gocd.yml"))
+}
@@ -0,0 +1,87 @@
+package source
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// validPrefix matches the prefixes GoCD allows in a config repo's ID
+var validPrefix = regexp.MustCompile(`^[a-zA-Z0-9_.-]*$`)
+
+// Owner is an org, group, ... to discover repos in, Prefix namespaces the IDs of the GoCD config repos
+// created for the owner's repos, so that each owner only ever reconciles its own config repos
+type Owner struct {
+	Name   string
+	Prefix string
+}
+
+// ParseOwners parses a comma separated list of owners, e.g. "gooflix,acme:ac", each owner can set its own config
+// repo ID prefix as <owner>:<prefix>, the prefix defaults to the owner's name with "/" replaced by "-"
+func ParseOwners(value string) ([]Owner, error) {
+
+	var owners []Owner
+
+	for _, entry := range strings.Split(value, ",") {
+
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// subgroups, e.g. tools/ci, have a "/" in their name which GoCD doesn't allow in an ID
+		owner := Owner{Name: entry, Prefix: strings.Replace(entry, "/", "-", -1)}
+		if i := strings.Index(entry, ":"); i > -1 {
+			owner.Name = strings.TrimSpace(entry[:i])
+			owner.Prefix = strings.TrimSpace(entry[i+1:])
+		}
+
+		if owner.Name == "" {
+			return nil, fmt.Errorf("missing name in %q", entry)
+		}
+
+		for _, o := range owners {
+			if o.Name == owner.Name {
+				return nil, fmt.Errorf("%s is listed more than once", owner.Name)
+			}
+		}
+
+		owners = append(owners, owner)
+	}
+
+	var prefixes []string
+	for _, owner := range owners {
+		prefixes = append(prefixes, owner.Prefix)
+	}
+
+	if err := ValidatePrefixes(prefixes); err != nil {
+		return nil, err
+	}
+
+	return owners, nil
+}
+
+// ValidatePrefixes makes sure no config repo can be owned by more than one prefix, else owners would remove
+// each other's config repos
+func ValidatePrefixes(prefixes []string) error {
+
+	for i, a := range prefixes {
+
+		// an empty prefix would own every single config repo in GoCD
+		if a == "" && len(prefixes) > 1 {
+			return fmt.Errorf("a prefix is required when seeding more than one owner")
+		}
+
+		if !validPrefix.MatchString(a) {
+			return fmt.Errorf("prefix %q may only contain letters, digits, \"_\", \"-\" and \".\"", a)
+		}
+
+		for _, b := range prefixes[i+1:] {
+			if a == b || strings.HasPrefix(a, b+"-") || strings.HasPrefix(b, a+"-") {
+				return fmt.Errorf("prefix %q overlaps with prefix %q", a, b)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package source_test
+
+import (
+	"testing"
+
+	"github.com/alex-leonhardt/gocd-seeder/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOwners(t *testing.T) {
+	owners, err := source.ParseOwners("platform, tools/ci:ci")
+	assert.Nil(t, err)
+	assert.Equal(t, []source.Owner{{Name: "platform", Prefix: "platform"}, {Name: "tools/ci", Prefix: "ci"}}, owners)
+
+	// nested groups get a prefix GoCD accepts in an ID
+	owners, err = source.ParseOwners("tools/ci")
+	assert.Nil(t, err)
+	assert.Equal(t, []source.Owner{{Name: "tools/ci", Prefix: "tools-ci"}}, owners)
+
+	_, err = source.ParseOwners("tools/ci:tools/ci")
+	assert.NotNil(t, err)
+
+	owners, err = source.ParseOwners("")
+	assert.Nil(t, err)
+	assert.Len(t, owners, 0)
+}
+
+func TestValidatePrefixes(t *testing.T) {
+	var validatePrefixesTests = []struct {
+		name     string
+		prefixes []string
+		err      bool
+	}{
+		{name: "none", prefixes: nil},
+		{name: "single_empty", prefixes: []string{""}},
+		{name: "distinct", prefixes: []string{"gooflix", "gl", "gooflix2"}},
+		{name: "empty_with_others", prefixes: []string{"", "gl"}, err: true},
+		{name: "duplicate", prefixes: []string{"gl", "gl"}, err: true},
+		{name: "overlap", prefixes: []string{"gl-tools", "gl"}, err: true},
+		{name: "invalid_characters", prefixes: []string{"tools/ci"}, err: true},
+	}
+
+	for _, tt := range validatePrefixesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := source.ValidatePrefixes(tt.prefixes)
+			assert.Equal(t, tt.err, err != nil)
+		})
+	}
+}
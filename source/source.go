@@ -0,0 +1,87 @@
+// Package source provides the repository model and the interface implemented by all repository sources
+// (Github, GitLab, ...) the seeder creates GoCD config repos for.
+package source
+
+import "time"
+
+// Repository is a repository found by a Source
+type Repository struct {
+	// ID is the source's immutable ID of the repository
+	ID string
+	// Name is used to name the config repo in GoCD, it must be unique within an owner
+	Name string
+	// FullName is the repository's name including its owner, e.g. gooflix/one
+	FullName      string
+	CloneURL      string
+	SSHURL        string
+	DefaultBranch string
+	Topics        []string
+	// Branch is the branch GoCD reads pipelines from, empty for the seeder's default
+	Branch string
+	// PluginID is the GoCD config repo plugin that parses the repo's pipelines, empty for the seeder's default
+	PluginID string
+	// Team is the team that owns the repo, if the source knows
+	Team string
+	// FilePattern is the pattern of the files GoCD reads pipelines from, empty for the seeder's default
+	FilePattern string
+	// MaterialName is the name of the config repo's material, empty for the repo's name
+	MaterialName string
+	// AutoUpdate is whether GoCD polls the repo for changes, nil for the seeder's default
+	AutoUpdate *bool
+	// BranchPatterns are the globs of the branches that get a config repo of their own, nil for the seeder's default
+	BranchPatterns []string
+	// Variant tells apart several config repos of the same repo, e.g. one per branch, it is part of their id
+	Variant string
+	// ConfigRepoID is the id of the repo's config repo if it was created under another name, e.g. before the repo was
+	// renamed, empty for the id made of its name
+	ConfigRepoID string
+	// Username and Password are what GoCD clones the repo with over https, empty if it needs none; the password is
+	// encrypted by GoCD before it is set on the config repo
+	Username string
+	Password string
+}
+
+// Ref returns the branch the repo's pipelines are read from, as far as the source knows
+func (r *Repository) Ref() string {
+	if r.Branch != "" {
+		return r.Branch
+	}
+	return r.DefaultBranch
+}
+
+// Source provides the repositories of a single owner (org, group, ...) to create GoCD config repos for
+type Source interface {
+	// Repos returns the repos to seed, and the repos that are skipped; config repos of skipped repos are kept
+	Repos() ([]*Repository, []*Repository, error)
+	// HasConfigFile returns true if the repo contains a file GoCD can read pipelines from on its Ref, the seeder sets
+	// the repo's Branch to the branch its config repo reads
+	HasConfigFile(*Repository) (bool, error)
+}
+
+// Credentialer is implemented by sources that provide the credentials GoCD clones their repos with
+type Credentialer interface {
+	// Credentials returns the username and password (e.g. a token) to clone the repo with, empty if none are needed
+	Credentials(repo *Repository) (string, string, error)
+}
+
+// Mover is implemented by sources whose repos can move between the seeded owners, e.g. be transferred to another org
+type Mover interface {
+	// Moved returns true if the repo with the id belongs to another of the seeded owners now
+	Moved(id string) (bool, error)
+}
+
+// Throttled is implemented by sources whose api is rate limited
+type Throttled interface {
+	// Delay returns how long to wait before the source is asked for repos again, 0 if it can be asked right away
+	Delay() time.Duration
+}
+
+// HasTopic returns true if the topic is one of the topics
+func HasTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}